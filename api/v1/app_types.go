@@ -29,6 +29,24 @@ type ControllerSpec struct {
 	For          ResourceType      `json:"for,omitempty"`
 	Dependencies []Dependency      `json:"dependencies,omitempty"`
 	Config       []ConfigSource    `json:"config,omitempty"`
+	// Related objects (that are not children) are read for every parent and
+	// passed to templates as request.related. Changes to them re-render the
+	// parents that selected them.
+	Related []Related `json:"related,omitempty"`
+	// ServiceAccountName is the name of a ServiceAccount (in the namespace of
+	// the Controller) to impersonate when applying and reading children.
+	// The permissions of the manager are used when not specified.
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// NamespacePolicy restricts the namespaces that children can be created
+	// in. Children can be created in any namespace when not specified.
+	NamespacePolicy *NamespacePolicy `json:"namespacePolicy,omitempty"`
+	// Chart is a packaged Helm chart that is rendered for every parent. The
+	// source (if any) maps the parent to the values of the chart by returning
+	// them as "values". The .spec of the parent is used as the values when
+	// there is no source.
+	Chart *ChartSource `json:"chart,omitempty"`
+	// Webhook delegates rendering to an HTTP endpoint instead of the source.
+	Webhook *Webhook `json:"webhook,omitempty"`
 }
 
 type ResourceType struct {
@@ -44,11 +62,105 @@ type Dependency struct {
 	Watch bool `json:"watch,omitempty"`
 }
 
+// NamespacePolicy determines the namespaces that children are allowed in.
+// A namespace is allowed if it matches any of the specified rules.
+type NamespacePolicy struct {
+	// SameNamespace allows children in the namespace of the parent.
+	SameNamespace bool `json:"sameNamespace,omitempty"`
+	// Allowed is a list of namespaces that children are allowed in.
+	Allowed []string `json:"allowed,omitempty"`
+	// Selector selects the namespaces (by label) that children are allowed in.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// ChartSource references a packaged Helm chart (.tgz).
+type ChartSource struct {
+	// ConfigMap (in the namespace of the Controller) that holds the chart,
+	// either as binary data or as base64 encoded data.
+	ConfigMap string `json:"configMap,omitempty"`
+	// Key of the chart in the ConfigMap. Defaults to "chart.tgz".
+	Key string `json:"key,omitempty"`
+	// Bundle is an inline base64 encoded chart.
+	Bundle string `json:"bundle,omitempty"`
+}
+
+// Webhook is an HTTP endpoint that renders parents.
+type Webhook struct {
+	// URL that requests are POSTed to.
+	URL string `json:"url"`
+	// Format of the requests and responses: "declare" (default) for the
+	// template input and output or "metacontroller" for the sync hook of a
+	// metacontroller CompositeController.
+	Format WebhookFormat `json:"format,omitempty"`
+	// Timeout of a single request. Defaults to 10s.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// Retries of requests that fail with a connection error or a 5xx
+	// response. Defaults to 2.
+	Retries *int32 `json:"retries,omitempty"`
+	// CABundle is a PEM encoded CA bundle to verify the certificate of the
+	// endpoint. The system roots are used when not specified.
+	CABundle []byte `json:"caBundle,omitempty"`
+	// Insecure allows for a plain http URL. Requests hold the config of the
+	// parent, including the values of Secrets.
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=declare;metacontroller
+type WebhookFormat string
+
+const (
+	WebhookFormatDeclare        WebhookFormat = "declare"
+	WebhookFormatMetacontroller WebhookFormat = "metacontroller"
+)
+
+// Related selects objects of a type by name or by label selector. The name
+// and the values of the label selector are Go templates that are rendered
+// with the parent object as data, i.e. "{{ .spec.policyRef }}".
+type Related struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// Namespace of the objects, defaults to the namespace of the parent. It
+	// is not a template (parents can not select objects in other namespaces)
+	// and it is ignored for cluster scoped types.
+	Namespace string `json:"namespace,omitempty"`
+	// Name selects a single object. Nothing is selected when the name
+	// renders empty.
+	Name string `json:"name,omitempty"`
+	// LabelSelector selects all matching objects.
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
+}
+
 type ConfigSource struct {
 	Secret    string `json:"secret,omitempty"`
 	ConfigMap string `json:"configMap,omitempty"`
+	// Keys selects the keys to load from the source. All keys are loaded
+	// when none are specified.
+	Keys []string `json:"keys,omitempty"`
+	// Prefix is prepended to every key loaded from the source.
+	Prefix string `json:"prefix,omitempty"`
+	// Optional allows for the selected keys to be missing.
+	Optional bool `json:"optional,omitempty"`
+	// Required fails loading the config when the source is missing. Missing
+	// sources are skipped by default.
+	Required bool `json:"required,omitempty"`
+	// Format of the values in the source: "string" (default), "json" or "yaml".
+	// Structured values are parsed into objects before being passed to templates.
+	Format ConfigFormat `json:"format,omitempty"`
+	// Reference passes placeholders to templates in place of Secret values.
+	// Placeholders are resolved when children are applied, keeping the values
+	// out of template output. Only supported for Secrets.
+	Reference bool `json:"reference,omitempty"`
 }
 
+// +kubebuilder:validation:Enum=string;json;yaml
+type ConfigFormat string
+
+const (
+	ConfigFormatString ConfigFormat = "string"
+	ConfigFormatJSON   ConfigFormat = "json"
+	ConfigFormatYAML   ConfigFormat = "yaml"
+)
+
 // ControllerStatus defines the observed state of Controller
 type ControllerStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
@@ -0,0 +1,370 @@
+// Command declare is a CLI for developing Controllers without a cluster.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/codeformio/declare/lint"
+	"github.com/codeformio/declare/render"
+	"github.com/codeformio/declare/scaffold"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = apiv1.AddToScheme(scheme)
+}
+
+const usage = `Usage: declare <command> [flags]
+
+Commands:
+  render    Render a Controller for a parent object and print the result
+  test      Run the golden test cases of Controllers
+  lint      Check Controllers for common mistakes
+  diff      Diff the children of a Controller against the live cluster
+  init      Generate the files of a new Controller
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "render":
+		err = runRender(os.Stdout, args)
+	case "test":
+		err = runTest(os.Stdout, args)
+	case "lint":
+		err = runLint(os.Stdout, args)
+	case "diff":
+		err = runDiff(os.Stdout, args)
+	case "init":
+		err = runInit(os.Stdout, args)
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// stringsFlag is a flag that can be specified multiple times.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string { return strings.Join(*s, ",") }
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+func runRender(out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	var (
+		controllerPath string
+		parentPath     string
+		configPaths    stringsFlag
+		fixturePaths   stringsFlag
+	)
+	fs.StringVar(&controllerPath, "controller", "", "Path to the Controller manifest.")
+	fs.StringVar(&parentPath, "parent", "", "Path to the parent object manifest.")
+	fs.Var(&configPaths, "config", "Path to a manifest with config Secrets or ConfigMaps (can be repeated).")
+	fs.Var(&fixturePaths, "fixtures", "Path to a manifest or a directory of manifests that getObject calls are resolved from (can be repeated).")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: declare render --controller <file> --parent <file> [--config <file>] [--fixtures <dir>]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if controllerPath == "" || parentPath == "" {
+		fs.Usage()
+		return fmt.Errorf("--controller and --parent are required")
+	}
+
+	c, err := render.ReadController(controllerPath)
+	if err != nil {
+		return err
+	}
+	parent, err := render.ReadObject(parentPath)
+	if err != nil {
+		return err
+	}
+
+	fixtures := render.NewFixtures(scheme)
+	for _, p := range append(configPaths, fixturePaths...) {
+		if err := fixtures.AddPath(p); err != nil {
+			return err
+		}
+	}
+
+	res, err := render.Render(context.Background(), fixtures, c, parent)
+	if err != nil {
+		return err
+	}
+
+	y, err := render.MarshalOutput(res)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(y)
+	return err
+}
+
+func runTest(out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	var update bool
+	fs.BoolVar(&update, "update", false, "Rewrite the expected output of the test cases instead of comparing it.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: declare test [--update] [<controller dir>...]\n\n")
+		fmt.Fprintf(fs.Output(), "Runs the test cases in the %s/ directory next to the %s of each directory.\n\n", render.TestsDir, render.ControllerFile)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	dirs := fs.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	var failed int
+	for _, dir := range dirs {
+		c, err := render.ReadController(filepath.Join(dir, render.ControllerFile))
+		if err != nil {
+			return err
+		}
+		cases, err := render.DiscoverTests(dir)
+		if err != nil {
+			return err
+		}
+		if len(cases) == 0 {
+			fmt.Fprintf(out, "?    %s\t[no test cases]\n", c.Name)
+			continue
+		}
+
+		for _, tc := range cases {
+			res, err := render.RunTest(context.Background(), scheme, c, tc, update)
+			switch {
+			case err != nil:
+				failed++
+				fmt.Fprintf(out, "FAIL %s/%s\n     %v\n", c.Name, tc.Name, err)
+			case res.Updated:
+				fmt.Fprintf(out, "UPD  %s/%s\n", c.Name, tc.Name)
+			case !res.Passed():
+				failed++
+				fmt.Fprintf(out, "FAIL %s/%s\n%s\n", c.Name, tc.Name, res.Diff)
+			default:
+				fmt.Fprintf(out, "ok   %s/%s\n", c.Name, tc.Name)
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d test case(s) failed (run with --update to accept the changes)", failed)
+	}
+	return nil
+}
+
+func runLint(out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: declare lint [<controller dir>...]\n\n")
+		fmt.Fprintf(fs.Output(), "Checks the %s of each directory. Its test cases are used as representative renders.\n", render.ControllerFile)
+	}
+	fs.Parse(args)
+
+	dirs := fs.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+
+	var errored bool
+	for _, dir := range dirs {
+		c, err := render.ReadController(filepath.Join(dir, render.ControllerFile))
+		if err != nil {
+			return err
+		}
+		findings, err := lint.Lint(context.Background(), scheme, c, dir)
+		if err != nil {
+			return err
+		}
+		for _, f := range findings {
+			fmt.Fprintf(out, "%s: %s\n", c.Name, f)
+		}
+		errored = errored || lint.HasErrors(findings)
+	}
+
+	if errored {
+		return fmt.Errorf("lint errors found")
+	}
+	return nil
+}
+
+func runDiff(out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	var (
+		controllerPath string
+		kubeconfig     string
+		namespace      string
+	)
+	fs.StringVar(&controllerPath, "controller", "", "Path to the (updated) Controller manifest.")
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Defaults to $KUBECONFIG, the in-cluster config or ~/.kube/config.")
+	fs.StringVar(&namespace, "namespace", "", "Only diff the instances in this namespace (defaults to all namespaces).")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: declare diff --controller <file> [--namespace <ns>]\n\n")
+		fmt.Fprintf(fs.Output(), "Renders the Controller for every existing instance of its parent type and diffs the children against the cluster. The cluster is only read from.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if controllerPath == "" {
+		fs.Usage()
+		return fmt.Errorf("--controller is required")
+	}
+
+	c, err := render.ReadController(controllerPath)
+	if err != nil {
+		return err
+	}
+
+	var cfg *rest.Config
+	if kubeconfig != "" {
+		cfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	} else {
+		cfg, err = ctrl.GetConfig()
+	}
+	if err != nil {
+		return fmt.Errorf("getting kubeconfig: %w", err)
+	}
+	cl, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return fmt.Errorf("creating client: %w", err)
+	}
+
+	mapper, err := apiutil.NewDynamicRESTMapper(cfg)
+	if err != nil {
+		return fmt.Errorf("creating REST mapper: %w", err)
+	}
+
+	// Only pass a reader to guarantee that nothing is written.
+	var reader client.Reader = cl
+	diffs, err := render.Diff(context.Background(), reader, mapper, c, client.InNamespace(namespace))
+	if err != nil {
+		return err
+	}
+
+	var created, changed, unchanged, failed int
+	for _, d := range diffs {
+		fmt.Fprintf(out, "%s %s\n", c.Spec.For.Kind, d.Parent)
+		if d.Error != nil {
+			failed++
+			fmt.Fprintf(out, "  ! error: %v\n", d.Error)
+			continue
+		}
+		for _, child := range d.Children {
+			apiVersion, kind := child.GroupVersionKind.ToAPIVersionAndKind()
+			name := child.Key.Name
+			if child.Key.Namespace != "" {
+				name = child.Key.String()
+			}
+			switch child.Status {
+			case render.ChildCreated:
+				created++
+				fmt.Fprintf(out, "  + %s %s %s\n", apiVersion, kind, name)
+			case render.ChildChanged:
+				changed++
+				fmt.Fprintf(out, "  ~ %s %s %s\n", apiVersion, kind, name)
+				for _, line := range strings.SplitAfter(strings.TrimSuffix(child.Diff, "\n"), "\n") {
+					fmt.Fprintf(out, "    %s", line)
+				}
+				fmt.Fprintln(out)
+			case render.ChildUnchanged:
+				unchanged++
+				fmt.Fprintf(out, "  = %s %s %s\n", apiVersion, kind, name)
+			case render.ChildInvalid:
+				failed++
+				fmt.Fprintf(out, "  ! %s %s %s: %s\n", apiVersion, kind, name, child.Diff)
+			}
+		}
+	}
+
+	fmt.Fprintf(out, "\n%d instance(s): %d child(ren) created, %d changed, %d unchanged, %d error(s)\n", len(diffs), created, changed, unchanged, failed)
+	return nil
+}
+
+func runInit(out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	var (
+		opts  scaffold.Options
+		dir   string
+		force bool
+	)
+	fs.StringVar(&opts.Kind, "kind", "", "Kind of the parent type, i.e. WebApp.")
+	fs.StringVar(&opts.Group, "group", "", "API group of the parent type, i.e. apps.example.com.")
+	fs.StringVar(&opts.Version, "version", "", "API version of the parent type (default \"v1alpha1\").")
+	fs.StringVar(&opts.Plural, "plural", "", "Plural name of the parent type (default: the lowercase kind + \"s\").")
+	fs.StringVar(&opts.Language, "lang", "jsonnet", "Language of the template: jsonnet or javascript.")
+	fs.StringVar(&dir, "dir", "", "Directory to generate the files in (default: the plural name).")
+	fs.BoolVar(&force, "force", false, "Overwrite existing files.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: declare init --kind <kind> --group <group> [--lang jsonnet|javascript] [--dir <dir>]\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	files, err := scaffold.Files(opts)
+	if err != nil {
+		fs.Usage()
+		return err
+	}
+	if dir == "" {
+		dir = opts.Plural
+		if dir == "" {
+			dir = strings.ToLower(opts.Kind) + "s"
+		}
+	}
+
+	paths := scaffold.Paths(files)
+	if !force {
+		for _, p := range paths {
+			if _, err := os.Stat(filepath.Join(dir, p)); err == nil {
+				return fmt.Errorf("%s already exists (use --force to overwrite)", filepath.Join(dir, p))
+			}
+		}
+	}
+
+	for _, p := range paths {
+		full := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(full, files[p], 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "created %s\n", full)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/codeformio/declare/template"
+	templatefactory "github.com/codeformio/declare/template/factory"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// templaterCache holds the templater for the current generation of a
+// Controller so that sources are not parsed (or compiled) on every reconcile.
+type templaterCache struct {
+	access templaterAccess
+
+	mu sync.Mutex
+
+	key       string
+	language  string
+	templater templatefactory.Templater
+}
+
+// get returns the templater (and its language) for the source of a
+// Controller, creating a new one if the Controller (or the ConfigMap holding
+// its chart) changed since the last call. The replaced templater is closed
+// (see template.Closer), as the parents of a Controller are reconciled one
+// at a time it is no longer in use.
+func (tc *templaterCache) get(ctx context.Context, cl client.Reader, c *apiv1.Controller) (templatefactory.Templater, string, error) {
+	key := fmt.Sprintf("%s/%d", c.UID, c.Generation)
+
+	chart, chartVersion, err := loadChart(ctx, cl, c)
+	if err != nil {
+		return nil, templatefactory.LangHelm, err
+	}
+	if chartVersion != "" {
+		key += "/" + chartVersion
+	}
+
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.templater != nil && tc.key == key {
+		templateCacheRequests.WithLabelValues(c.Name, "hit").Inc()
+		return tc.templater, tc.language, nil
+	}
+	templateCacheRequests.WithLabelValues(c.Name, "miss").Inc()
+
+	tmpl, lang, err := newTemplater(c, chart, tc.access)
+	if err != nil {
+		return nil, lang, err
+	}
+
+	if tc.templater != nil {
+		if err := template.Close(ctx, tc.templater); err != nil {
+			return nil, lang, fmt.Errorf("closing replaced templater: %w", err)
+		}
+	}
+	tc.key, tc.language, tc.templater = key, lang, tmpl
+
+	return tmpl, lang, nil
+}
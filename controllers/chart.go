@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	templatefactory "github.com/codeformio/declare/template/factory"
+	"github.com/codeformio/declare/template/helm"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultChartKey is the key of the chart in a ConfigMap when not specified.
+const defaultChartKey = "chart.tgz"
+
+// NewTemplater returns the templater (and its language) for the source, chart
+// or webhook of a Controller, the same way as it is created when reconciling.
+func NewTemplater(ctx context.Context, cl client.Reader, c *apiv1.Controller) (templatefactory.Templater, string, error) {
+	chart, _, err := loadChart(ctx, cl, c)
+	if err != nil {
+		return nil, templatefactory.LangHelm, err
+	}
+	return newTemplater(c, chart, templaterAccess{})
+}
+
+// templaterAccess is how templaters access the cluster beyond the reader
+// passed to Template. The zero value (used when rendering offline) does not
+// access the cluster.
+type templaterAccess struct {
+	// children lists the children of parents (see setupOwnerIndexes).
+	children client.Reader
+	mapper   meta.RESTMapper
+	// restConfig is impersonated by lookups of charts.
+	restConfig *rest.Config
+}
+
+// chartOptions returns the options of the chart of a Controller. lookup
+// impersonates the ServiceAccount of the Controller, without one it does not
+// read the cluster (it is not served with the permissions of the manager).
+func (a templaterAccess) chartOptions(c *apiv1.Controller) helm.Options {
+	opts := helm.Options{Mapper: a.mapper, ChildReader: a.children}
+	for _, d := range c.Spec.Dependencies {
+		opts.Types = append(opts.Types, schema.FromAPIVersionAndKind(d.APIVersion, d.Kind))
+	}
+	if a.restConfig != nil && c.Spec.ServiceAccountName != "" {
+		opts.Config = impersonate(a.restConfig, c)
+	}
+	return opts
+}
+
+func newTemplater(c *apiv1.Controller, chart []byte, access templaterAccess) (templatefactory.Templater, string, error) {
+	if c.Spec.Webhook != nil {
+		tmpl, err := newWebhook(c, access.children)
+		return tmpl, templatefactory.LangWebhook, err
+	}
+	if c.Spec.Chart != nil {
+		tmpl, err := templatefactory.NewChart(chart, c.Spec.Source, access.chartOptions(c))
+		return tmpl, templatefactory.LangHelm, err
+	}
+
+	lang, err := templatefactory.Language(c.Spec.Source)
+	if err != nil {
+		return nil, "", err
+	}
+	tmpl, err := templatefactory.New(c.Spec.Source)
+	return tmpl, lang, err
+}
+
+// loadChart returns the packaged chart of a Controller (nil if there is
+// none) and a version that changes when a chart in a ConfigMap is updated.
+func loadChart(ctx context.Context, cl client.Reader, c *apiv1.Controller) ([]byte, string, error) {
+	src := c.Spec.Chart
+	switch {
+	case src == nil:
+		return nil, "", nil
+
+	case src.Bundle != "" && src.ConfigMap != "":
+		return nil, "", fmt.Errorf("chart can not specify both a bundle and configMap %q", src.ConfigMap)
+
+	case src.Bundle != "":
+		chart, err := base64.StdEncoding.DecodeString(src.Bundle)
+		if err != nil {
+			return nil, "", fmt.Errorf("decoding chart bundle: %w", err)
+		}
+		return chart, "", nil
+
+	case src.ConfigMap != "":
+		key := src.Key
+		if key == "" {
+			key = defaultChartKey
+		}
+
+		var cm corev1.ConfigMap
+		if err := cl.Get(ctx, types.NamespacedName{Namespace: c.Namespace, Name: src.ConfigMap}, &cm); err != nil {
+			return nil, "", fmt.Errorf("getting chart configmap %q: %w", src.ConfigMap, err)
+		}
+		if chart, ok := cm.BinaryData[key]; ok {
+			return chart, cm.ResourceVersion, nil
+		}
+		if data, ok := cm.Data[key]; ok {
+			chart, err := base64.StdEncoding.DecodeString(data)
+			if err != nil {
+				return nil, "", fmt.Errorf("decoding chart in configmap %q: %w", src.ConfigMap, err)
+			}
+			return chart, cm.ResourceVersion, nil
+		}
+		return nil, "", fmt.Errorf("chart configmap %q does not contain key %q", src.ConfigMap, key)
+
+	default:
+		return nil, "", fmt.Errorf("chart must specify a bundle or configMap")
+	}
+}
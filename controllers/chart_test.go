@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestLoadChart(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	cl := fake.NewFakeClientWithScheme(scheme,
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "binary", Namespace: "default"},
+			BinaryData: map[string][]byte{"chart.tgz": []byte("binary-chart")},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "encoded", Namespace: "default"},
+			Data:       map[string]string{"web.tgz": base64.StdEncoding.EncodeToString([]byte("encoded-chart"))},
+		},
+	)
+
+	cases := []struct {
+		name   string
+		chart  *apiv1.ChartSource
+		output string
+		errors bool
+	}{
+		{name: "none"},
+		{name: "bundle", chart: &apiv1.ChartSource{Bundle: base64.StdEncoding.EncodeToString([]byte("bundled-chart"))}, output: "bundled-chart"},
+		{name: "invalidBundle", chart: &apiv1.ChartSource{Bundle: "%%%"}, errors: true},
+		{name: "binaryData", chart: &apiv1.ChartSource{ConfigMap: "binary"}, output: "binary-chart"},
+		{name: "data", chart: &apiv1.ChartSource{ConfigMap: "encoded", Key: "web.tgz"}, output: "encoded-chart"},
+		{name: "missingKey", chart: &apiv1.ChartSource{ConfigMap: "encoded"}, errors: true},
+		{name: "missingConfigMap", chart: &apiv1.ChartSource{ConfigMap: "missing"}, errors: true},
+		{name: "both", chart: &apiv1.ChartSource{ConfigMap: "binary", Bundle: "Y2hhcnQ="}, errors: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctrl := &apiv1.Controller{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+				Spec:       apiv1.ControllerSpec{Chart: c.chart},
+			}
+			chart, _, err := loadChart(context.Background(), cl, ctrl)
+			if c.errors {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.output, string(chart))
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// AnnotationConfigKey can be set on parent objects to reference
+	// additional config (in the parent's namespace) that is merged on top of
+	// the config of the Controller. The value is a YAML (or JSON) list of
+	// config sources, for example: `[{configMap: my-overrides}]`.
+	AnnotationConfigKey = "ctrl.declare.dev/config"
+)
+
+// LoadConfig loads the config of a Controller (including the config
+// referenced by the parent object) the same way as it is loaded when
+// reconciling, see loadAllConfig. The returned Secrets resolve the secret
+// references in the config.
+func LoadConfig(ctx context.Context, cl client.Reader, c *apiv1.Controller, main *unstructured.Unstructured) (map[string]interface{}, *Secrets, error) {
+	rd := &redactor{}
+	cfg, _, err := loadAllConfig(ctx, cl, rd, c, main)
+	if err != nil {
+		return nil, nil, rd.Error(err)
+	}
+	return cfg, &Secrets{rd: rd}, nil
+}
+
+// Secrets resolves and redacts the Secret values loaded by LoadConfig.
+type Secrets struct {
+	rd *redactor
+}
+
+// Resolve replaces secret references with their values in an unstructured
+// object (in place), the same way as it is done before applying children.
+func (s *Secrets) Resolve(obj map[string]interface{}) error {
+	return s.rd.Resolve(obj)
+}
+
+// Redact redacts all Secret values in a string.
+func (s *Secrets) Redact(str string) string {
+	return s.rd.String(str)
+}
+
+// loadAllConfig loads the config of a Controller and merges the config
+// referenced by the parent object on top of it. The returned warnings
+// describe keys that are defined by multiple sources of the Controller (or
+// of the parent).
+func loadAllConfig(ctx context.Context, cl client.Reader, rd *redactor, c *apiv1.Controller, main *unstructured.Unstructured) (map[string]interface{}, []string, error) {
+	cfg, warnings, err := loadConfig(ctx, cl, rd, c.Namespace, c.Spec.Config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	instanceSrcs, err := instanceConfigSources(main)
+	if err != nil {
+		return nil, nil, err
+	}
+	instanceCfg, instanceWarnings, err := loadConfig(ctx, cl, rd, main.GetNamespace(), instanceSrcs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range instanceCfg {
+		cfg[k] = v
+	}
+
+	return cfg, append(warnings, instanceWarnings...), nil
+}
+
+// loadConfig loads the config from all sources in the given namespace.
+// Missing sources are skipped, an error is returned when a required source
+// (or a selected key) is missing. When
+// multiple sources define the same key, the last source wins and a warning
+// is returned. Values loaded from Secrets are recorded as sensitive in the
+// redactor.
+func loadConfig(ctx context.Context, c client.Reader, rd *redactor, namespace string, srcs []apiv1.ConfigSource) (map[string]interface{}, []string, error) {
+	cfg := make(map[string]interface{})
+	from := make(map[string]string)
+	var warnings []string
+
+	for _, src := range srcs {
+		data, err := getConfigSource(ctx, c, namespace, src)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if src.Secret != "" {
+			for k, v := range data {
+				if src.Reference {
+					rd.addReference(rd.reference(namespace, src.Secret, k), v)
+				} else {
+					rd.add(v)
+				}
+			}
+		}
+
+		values, err := selectConfig(rd, namespace, src, data)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, k := range sortedKeys(values) {
+			if prev, ok := from[k]; ok {
+				warnings = append(warnings, fmt.Sprintf("config key %q in source %s overrides the key in source %s", k, configSourceName(src), prev))
+			}
+			cfg[k] = values[k]
+			from[k] = configSourceName(src)
+		}
+	}
+
+	return cfg, warnings, nil
+}
+
+// getConfigSource returns the data of the Secret or ConfigMap referenced by
+// the source. A nil map is returned when the source is not found (unless it
+// is required).
+func getConfigSource(ctx context.Context, c client.Reader, namespace string, src apiv1.ConfigSource) (map[string]string, error) {
+	key := types.NamespacedName{Namespace: namespace}
+
+	switch {
+	case src.Secret != "" && src.ConfigMap != "":
+		return nil, fmt.Errorf("config source can not specify both secret %q and configMap %q", src.Secret, src.ConfigMap)
+
+	case src.Secret != "":
+		key.Name = src.Secret
+		var s corev1.Secret
+		if err := c.Get(ctx, key, &s); err != nil {
+			if apierrors.IsNotFound(err) && !src.Required {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("getting config secret %q: %w", key.Name, err)
+		}
+		data := make(map[string]string, len(s.Data))
+		for k, v := range s.Data {
+			data[k] = string(v)
+		}
+		return data, nil
+
+	case src.ConfigMap != "":
+		key.Name = src.ConfigMap
+		var cm corev1.ConfigMap
+		if err := c.Get(ctx, key, &cm); err != nil {
+			if apierrors.IsNotFound(err) && !src.Required {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("getting config configmap %q: %w", key.Name, err)
+		}
+		return cm.Data, nil
+
+	default:
+		return nil, fmt.Errorf("config source must specify a secret or configMap")
+	}
+}
+
+// selectConfig selects and parses the keys from the data of a config
+// source according to the source's options. Secret references are created
+// by the redactor.
+func selectConfig(rd *redactor, namespace string, src apiv1.ConfigSource, data map[string]string) (map[string]interface{}, error) {
+	if src.Reference {
+		if src.Secret == "" {
+			return nil, fmt.Errorf("config source %s: reference is only supported for secrets", configSourceName(src))
+		}
+		if src.Format != "" && src.Format != apiv1.ConfigFormatString {
+			return nil, fmt.Errorf("config source %s: reference can not be combined with format %q", configSourceName(src), src.Format)
+		}
+	}
+
+	if data == nil {
+		return nil, nil
+	}
+
+	selected := data
+	if len(src.Keys) > 0 {
+		selected = make(map[string]string, len(src.Keys))
+		for _, k := range src.Keys {
+			v, ok := data[k]
+			if !ok {
+				if src.Optional {
+					continue
+				}
+				return nil, fmt.Errorf("config key %q not found in source %s", k, configSourceName(src))
+			}
+			selected[k] = v
+		}
+	}
+
+	values := make(map[string]interface{}, len(selected))
+	for k, v := range selected {
+		var val interface{}
+		switch {
+		case src.Reference:
+			val = rd.reference(namespace, src.Secret, k)
+		case src.Format == "" || src.Format == apiv1.ConfigFormatString:
+			val = v
+		case src.Format == apiv1.ConfigFormatJSON:
+			if err := json.Unmarshal([]byte(v), &val); err != nil {
+				return nil, fmt.Errorf("parsing config key %q in source %s as json: %w", k, configSourceName(src), err)
+			}
+		case src.Format == apiv1.ConfigFormatYAML:
+			if err := yaml.Unmarshal([]byte(v), &val); err != nil {
+				return nil, fmt.Errorf("parsing config key %q in source %s as yaml: %w", k, configSourceName(src), err)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported config format %q in source %s", src.Format, configSourceName(src))
+		}
+		values[src.Prefix+k] = val
+	}
+
+	return values, nil
+}
+
+func configSourceName(src apiv1.ConfigSource) string {
+	if src.Secret != "" {
+		return "secret/" + src.Secret
+	}
+	return "configmap/" + src.ConfigMap
+}
+
+// instanceConfigSources returns the config sources referenced by a parent
+// object through the AnnotationConfigKey annotation.
+func instanceConfigSources(obj metav1.Object) ([]apiv1.ConfigSource, error) {
+	val, ok := obj.GetAnnotations()[AnnotationConfigKey]
+	if !ok {
+		return nil, nil
+	}
+
+	var srcs []apiv1.ConfigSource
+	if err := yaml.Unmarshal([]byte(val), &srcs); err != nil {
+		return nil, fmt.Errorf("parsing %s annotation: %w", AnnotationConfigKey, err)
+	}
+
+	return srcs, nil
+}
+
+// sortedKeys returns the keys of a map in order.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setCondition sets a condition in the .status.conditions list of an
+// unstructured object, replacing any existing condition of the same type.
+// It reports whether the condition changed.
+func setCondition(obj map[string]interface{}, condType, status, reason, message string) bool {
+	cond := map[string]interface{}{
+		"type":               condType,
+		"status":             status,
+		"reason":             reason,
+		"message":            message,
+		"lastTransitionTime": metav1.Now().UTC().Format(time.RFC3339),
+	}
+
+	prev := getCondition(obj, condType)
+	if prev != nil && prev["status"] == status {
+		cond["lastTransitionTime"] = prev["lastTransitionTime"]
+	}
+	putCondition(obj, cond)
+
+	return prev == nil || prev["status"] != status || prev["reason"] != reason || prev["message"] != message
+}
+
+// getCondition returns the condition of the given type in the
+// .status.conditions list of an unstructured object (or nil).
+func getCondition(obj map[string]interface{}, condType string) map[string]interface{} {
+	st, _ := obj["status"].(map[string]interface{})
+	conds, _ := st["conditions"].([]interface{})
+	for _, c := range conds {
+		if m, ok := c.(map[string]interface{}); ok && m["type"] == condType {
+			return m
+		}
+	}
+	return nil
+}
+
+// putCondition puts a condition into the .status.conditions list of an
+// unstructured object, replacing any existing condition of the same type.
+func putCondition(obj map[string]interface{}, cond map[string]interface{}) {
+	st, _ := obj["status"].(map[string]interface{})
+	if st == nil {
+		st = make(map[string]interface{})
+		obj["status"] = st
+	}
+
+	conds, _ := st["conditions"].([]interface{})
+	for i, c := range conds {
+		if m, ok := c.(map[string]interface{}); ok && m["type"] == cond["type"] {
+			conds[i] = cond
+			return
+		}
+	}
+	st["conditions"] = append(conds, cond)
+}
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSelectConfig(t *testing.T) {
+	data := map[string]string{
+		"address": "http://prometheus:9090",
+		"limits":  "cpu: 500m\nmemory: 1Gi\n",
+		"ports":   "[80, 443]",
+	}
+
+	cases := []struct {
+		name   string
+		src    apiv1.ConfigSource
+		data   map[string]string
+		output map[string]interface{}
+		errors bool
+	}{
+		{
+			name: "all",
+			src:  apiv1.ConfigSource{ConfigMap: "cfg"},
+			data: data,
+			output: map[string]interface{}{
+				"address": "http://prometheus:9090",
+				"limits":  "cpu: 500m\nmemory: 1Gi\n",
+				"ports":   "[80, 443]",
+			},
+		},
+		{
+			name:   "keysAndPrefix",
+			src:    apiv1.ConfigSource{ConfigMap: "cfg", Keys: []string{"address"}, Prefix: "prometheus."},
+			data:   data,
+			output: map[string]interface{}{"prometheus.address": "http://prometheus:9090"},
+		},
+		{
+			name:   "yaml",
+			src:    apiv1.ConfigSource{ConfigMap: "cfg", Keys: []string{"limits"}, Format: apiv1.ConfigFormatYAML},
+			data:   data,
+			output: map[string]interface{}{"limits": map[string]interface{}{"cpu": "500m", "memory": "1Gi"}},
+		},
+		{
+			name:   "json",
+			src:    apiv1.ConfigSource{ConfigMap: "cfg", Keys: []string{"ports"}, Format: apiv1.ConfigFormatJSON},
+			data:   data,
+			output: map[string]interface{}{"ports": []interface{}{int64(80), int64(443)}},
+		},
+		{
+			name:   "invalidJSON",
+			src:    apiv1.ConfigSource{ConfigMap: "cfg", Keys: []string{"limits"}, Format: apiv1.ConfigFormatJSON},
+			data:   data,
+			errors: true,
+		},
+		{
+			name:   "missingRequiredKey",
+			src:    apiv1.ConfigSource{ConfigMap: "cfg", Keys: []string{"other"}},
+			data:   data,
+			errors: true,
+		},
+		{
+			name:   "missingOptionalKey",
+			src:    apiv1.ConfigSource{ConfigMap: "cfg", Keys: []string{"other"}, Optional: true},
+			data:   data,
+			output: map[string]interface{}{},
+		},
+		{
+			name:   "reference",
+			src:    apiv1.ConfigSource{Secret: "creds", Keys: []string{"address"}, Reference: true},
+			data:   data,
+			output: map[string]interface{}{"address": "$(secret:n0nce:default/creds/address)"},
+		},
+		{
+			name:   "referenceConfigMap",
+			src:    apiv1.ConfigSource{ConfigMap: "cfg", Reference: true},
+			data:   data,
+			errors: true,
+		},
+		{
+			name:   "missingSource",
+			src:    apiv1.ConfigSource{ConfigMap: "cfg"},
+			data:   nil,
+			output: nil,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out, err := selectConfig(&redactor{nonce: "n0nce"}, "default", c.src, c.data)
+			if c.errors {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.output, out)
+		})
+	}
+}
+
+func TestGetConfigSource(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	cl := fake.NewFakeClientWithScheme(scheme,
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "cfg", Namespace: "default"},
+			Data:       map[string]string{"a": "b"},
+		},
+	)
+
+	cases := []struct {
+		name   string
+		src    apiv1.ConfigSource
+		output map[string]string
+		errors bool
+	}{
+		{name: "found", src: apiv1.ConfigSource{ConfigMap: "cfg"}, output: map[string]string{"a": "b"}},
+		// Missing sources are skipped (unless required).
+		{name: "missingConfigMap", src: apiv1.ConfigSource{ConfigMap: "missing"}},
+		{name: "missingSecret", src: apiv1.ConfigSource{Secret: "missing"}},
+		{name: "requiredConfigMap", src: apiv1.ConfigSource{ConfigMap: "missing", Required: true}, errors: true},
+		{name: "requiredSecret", src: apiv1.ConfigSource{Secret: "missing", Required: true}, errors: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out, err := getConfigSource(context.Background(), cl, "default", c.src)
+			if c.errors {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.output, out)
+		})
+	}
+}
+
+func TestInstanceConfigSources(t *testing.T) {
+	var obj unstructured.Unstructured
+	obj.SetAnnotations(map[string]string{
+		AnnotationConfigKey: `[{configMap: overrides, keys: [replicas], format: yaml}, {secret: creds, optional: true}]`,
+	})
+
+	srcs, err := instanceConfigSources(&obj)
+	require.NoError(t, err)
+	require.Equal(t, []apiv1.ConfigSource{
+		{ConfigMap: "overrides", Keys: []string{"replicas"}, Format: apiv1.ConfigFormatYAML},
+		{Secret: "creds", Optional: true},
+	}, srcs)
+}
+
+func TestLoadConfigDuplicateKeys(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	cl := fake.NewFakeClientWithScheme(scheme,
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "defaults", Namespace: "default"},
+			Data:       map[string]string{"replicas": "1", "image": "nginx"},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "overrides", Namespace: "default"},
+			Data:       map[string]string{"replicas": "3"},
+		},
+	)
+
+	// The last source wins (like before duplicate keys were detected), the
+	// override is reported as a warning.
+	cfg, warnings, err := loadConfig(context.Background(), cl, &redactor{}, "default", []apiv1.ConfigSource{
+		{ConfigMap: "defaults"},
+		{ConfigMap: "overrides"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"replicas": "3", "image": "nginx"}, cfg)
+	require.Equal(t, []string{`config key "replicas" in source configmap/overrides overrides the key in source configmap/defaults`}, warnings)
+}
+
+func TestSetCondition(t *testing.T) {
+	obj := map[string]interface{}{}
+
+	require.True(t, setCondition(obj, ConditionTypeConfigLoaded, "False", EventReasonFailedLoadingConfig, "missing"))
+	require.False(t, setCondition(obj, ConditionTypeConfigLoaded, "False", EventReasonFailedLoadingConfig, "missing"))
+
+	// A previous failure is cleared.
+	require.True(t, setCondition(obj, ConditionTypeConfigLoaded, "True", ConditionReasonConfigLoaded, ""))
+	cond := getCondition(obj, ConditionTypeConfigLoaded)
+	require.Equal(t, "True", cond["status"])
+	require.Equal(t, "", cond["message"])
+	require.Len(t, obj["status"].(map[string]interface{})["conditions"], 1)
+}
@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+// LabelConfig marks the Secrets and ConfigMaps that are used as config (see
+// apiv1.ConfigSource). Only config objects with this label are watched,
+// changes to other config objects are picked up by the next reconcile.
+const LabelConfig = "ctrl.declare.dev/config"
+
+// configResync is the resync period of the config informers.
+const configResync = 10 * time.Hour
+
+// configInformers watch the config objects of all Controllers. Unlike the
+// manager's cache, which would list and watch every Secret and ConfigMap in
+// the cluster, only objects labelled with LabelConfig are watched. Events
+// are mapped to the Controllers (and parents) that reference the objects by
+// the indexes in index.go.
+type configInformers struct {
+	secrets    toolscache.SharedIndexInformer
+	configMaps toolscache.SharedIndexInformer
+}
+
+// newConfigInformers returns the config informers for a client of the core
+// API group (i.e. a CoreV1().RESTClient()).
+func newConfigInformers(getter toolscache.Getter) *configInformers {
+	return &configInformers{
+		secrets:    newConfigInformer(getter, "secrets", &corev1.Secret{}),
+		configMaps: newConfigInformer(getter, "configmaps", &corev1.ConfigMap{}),
+	}
+}
+
+func newConfigInformer(getter toolscache.Getter, resource string, obj runtime.Object) toolscache.SharedIndexInformer {
+	lw := toolscache.NewFilteredListWatchFromClient(getter, resource, metav1.NamespaceAll, func(opts *metav1.ListOptions) {
+		opts.LabelSelector = LabelConfig
+	})
+	return toolscache.NewSharedIndexInformer(lw, obj, configResync, toolscache.Indexers{})
+}
+
+// Start runs the informers until stop is closed (implements
+// manager.Runnable).
+func (ci *configInformers) Start(stop <-chan struct{}) error {
+	go ci.secrets.Run(stop)
+	go ci.configMaps.Run(stop)
+	<-stop
+	return nil
+}
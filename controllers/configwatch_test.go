@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+func TestConfigInformers(t *testing.T) {
+	// Stand-in for the API server that returns an empty list for every list
+	// request and keeps watches open.
+	selectors := make(chan string, 10)
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("watch") == "true" {
+			w.Header().Set("Content-Type", "application/json")
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-done:
+			}
+			return
+		}
+		selectors <- r.URL.Path + "?" + r.URL.Query().Get("labelSelector")
+		kind := "SecretList"
+		if r.URL.Path == "/api/v1/configmaps" {
+			kind = "ConfigMapList"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"kind": %q, "apiVersion": "v1", "metadata": {"resourceVersion": "1"}, "items": []}`, kind)
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	cl, err := corev1client.NewForConfig(&rest.Config{Host: srv.URL})
+	require.NoError(t, err)
+	ci := newConfigInformers(cl.RESTClient())
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go ci.Start(stop)
+	require.True(t, toolscache.WaitForCacheSync(stop, ci.secrets.HasSynced, ci.configMaps.HasSynced))
+
+	// Only labelled config objects are listed (and watched) across all
+	// namespaces.
+	var got []string
+	for len(got) < 2 {
+		select {
+		case s := <-selectors:
+			got = append(got, s)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for list requests")
+		}
+	}
+	require.ElementsMatch(t, []string{"/api/v1/secrets?" + LabelConfig, "/api/v1/configmaps?" + LabelConfig}, got)
+}
@@ -2,28 +2,36 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/codeformio/declare/template"
-	templatefactory "github.com/codeformio/declare/template/factory"
+	"github.com/codeformio/declare/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	apiv1 "github.com/codeformio/declare/api/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
@@ -35,9 +43,23 @@ const (
 	// AnnotationOwnershipValueNonController sets an owner reference without "controller: true".
 	AnnotationOwnershipValueNonController = "non-controller"
 
-	EventReasonFailedTemplating = "FailedTemplating"
-	EventReasonFailedApplying   = "FailedApplying"
-	EventReasonApplied          = "Applied"
+	EventReasonFailedLoadingConfig = "FailedLoadingConfig"
+	EventReasonOverriddenConfig    = "OverriddenConfig"
+	EventReasonFailedTemplating    = "FailedTemplating"
+	EventReasonFailedApplying      = "FailedApplying"
+	EventReasonApplied             = "Applied"
+
+	// ConditionTypeConfigLoaded is set on the parent when config is loaded
+	// ("True") or could not be loaded ("False").
+	ConditionTypeConfigLoaded   = "ConfigLoaded"
+	ConditionReasonConfigLoaded = "Loaded"
+
+	// ConditionTypeParentUpdated is set on the parent when the update
+	// returned by a template is applied ("True") or conflicts with fields
+	// managed by someone else ("False").
+	ConditionTypeParentUpdated    = "ParentUpdated"
+	ConditionReasonParentUpdated  = "Updated"
+	ConditionReasonParentConflict = "Conflict"
 )
 
 // ControllerCRDReconciler reconciles a CRD created by SiteDefinition with SiteDeployment objects.
@@ -46,13 +68,47 @@ type ControllerCRDReconciler struct {
 
 	controllerInfo
 
-	recorder record.EventRecorder
-	client   client.Client
-	scheme   *runtime.Scheme
+	recorder   record.EventRecorder
+	client     client.Client
+	scheme     *runtime.Scheme
+	restConfig *rest.Config
+	mapper     meta.RESTMapper
+	// apiReader reads config objects from the API server. Reading them
+	// through the manager's client would cache (and watch) all Secrets and
+	// ConfigMaps in the cluster.
+	apiReader client.Reader
+
+	configInformers *configInformers
+
+	// requireServiceAccount rejects Controllers that do not specify a
+	// ServiceAccount (see Options).
+	requireServiceAccount bool
+	// impersonated holds clients for Controllers that specify a
+	// ServiceAccount, keyed by username.
+	impersonated   map[string]client.Client
+	impersonatedMu sync.Mutex
+
+	templaters templaterCache
+	renders    *RenderRecorder
+	// childVersions holds the last applied resourceVersion of the children
+	// of each parent (by parent) which is used to detect unchanged children.
+	childVersions sync.Map
+
+	// controller is used to add watches for the types of objects read by
+	// templates, reads is the index of which parents read which objects.
+	controller    controller.Controller
+	reads         readIndex
+	readWatches   map[schema.GroupVersionKind]bool
+	readWatchesMu sync.Mutex
 }
 
 func (r *ControllerCRDReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	ctx := context.Background()
+	ctx, span := tracing.Tracer().Start(context.Background(), "Reconcile", trace.WithAttributes(
+		attribute.String("controller", r.controllerName),
+		attribute.String("namespace", req.Namespace),
+		attribute.String("name", req.Name),
+	))
+	defer span.End()
 	log := r.Log.WithValues(strings.ToLower(r.mainType.Kind), req.NamespacedName)
 
 	log.Info("Received reconcile request", "name", req.NamespacedName)
@@ -62,12 +118,20 @@ func (r *ControllerCRDReconciler) Reconcile(req ctrl.Request) (ctrl.Result, erro
 	main.SetGroupVersionKind(r.mainType)
 	if err := r.client.Get(ctx, req.NamespacedName, &main); err != nil {
 		if apierrors.IsNotFound(err) {
+			r.renders.delete(r.controllerName, req.NamespacedName)
+			r.reads.delete(req.NamespacedName)
+			r.childVersions.Delete(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
 		return ctrl.Result{}, fmt.Errorf("getting main resource: %w", err)
 	}
 
 	log.Info("Reconciling", "name", main.GetName())
+	span.SetAttributes(attribute.String("parent.uid", string(main.GetUID())))
+
+	// Record the outcome of this reconcile for debugging.
+	rec := &renderRecord{Time: time.Now()}
+	defer r.renders.set(r.controllerName, req.NamespacedName, rec)
 
 	// Get Controller that corresponds to the main resource.
 	var c apiv1.Controller
@@ -84,77 +148,115 @@ func (r *ControllerCRDReconciler) Reconcile(req ctrl.Request) (ctrl.Result, erro
 		dependencies[schema.FromAPIVersionAndKind(c.APIVersion, c.Kind)] = true
 	}
 
-	cfg := make(map[string]string)
-	// Add ownership to referenced configuration (Secrets/ConfigMaps).
-	for _, cfgSrc := range c.Spec.Config {
-		lg := log.WithValues("namespace", c.Namespace)
-		// TODO: Validate that only one source is defined per ConfigSource.
-		if name := cfgSrc.Secret; name != "" {
-			lg := lg.WithValues("name", name)
-			lg.Info("Getting config Secret")
-			var s corev1.Secret
-			if err := r.client.Get(ctx, types.NamespacedName{Name: name, Namespace: c.Namespace}, &s); err != nil {
-				if apierrors.IsNotFound(err) {
-					lg.Info("Config Secret not found")
-				} else {
-					log.Error(err, "Error getting config Secret")
-				}
-				continue
-			}
-			// TODO: Check if already owner.
-			if err := controllerutil.SetOwnerReference(&c, &s, r.scheme); err != nil {
-				return ctrl.Result{}, fmt.Errorf("setting owner reference on secret: %w", err)
-			}
-			if err := r.client.Update(ctx, &s); err != nil {
-				return ctrl.Result{}, fmt.Errorf("updating config secret with owner reference: %v", err)
-			}
-			for k, v := range s.Data {
-				cfg[k] = string(v)
-			}
+	// Children are applied (and read by templates) using the Controller's
+	// ServiceAccount if one is specified. Templates list objects from the
+	// cache (see templateReader).
+	childClient, err := r.childClient(&c)
+	if err != nil {
+		if errors.Is(err, errServiceAccountRequired) {
+			rec.Error = err.Error()
+			r.recorder.Event(&main, corev1.EventTypeWarning, EventReasonFailedTemplating, err.Error())
+			log.Info("getting child client", "error", err.Error())
+			return ctrl.Result{}, nil
 		}
-		if name := cfgSrc.ConfigMap; name != "" {
-			lg := lg.WithValues("name", name)
-			lg.Info("Getting config ConfigMap")
-			var cm corev1.ConfigMap
-			if err := r.client.Get(ctx, types.NamespacedName{Name: name, Namespace: c.Namespace}, &cm); err != nil {
-				if apierrors.IsNotFound(err) {
-					lg.Info("Config ConfigMap not found")
-				} else {
-					log.Error(err, "Error getting config ConfigMap")
-				}
-				continue
-			}
-			// TODO: Check if already owner.
-			if err := controllerutil.SetOwnerReference(&c, &cm, r.scheme); err != nil {
-				return ctrl.Result{}, fmt.Errorf("setting owner reference on configmap: %w", err)
-			}
-			if err := r.client.Update(ctx, &cm); err != nil {
-				return ctrl.Result{}, fmt.Errorf("updating config configmap with owner reference: %v", err)
-			}
-			for k, v := range cm.Data {
-				cfg[k] = string(v)
-			}
+		return ctrl.Result{}, err
+	}
+	// Config (and chart) objects are read with the Controller's
+	// ServiceAccount as well, without one they are read by the manager.
+	configReader := r.apiReader
+	if c.Spec.ServiceAccountName != "" {
+		configReader = childClient
+	}
+
+	// Load referenced configuration (Secrets/ConfigMaps). These objects are
+	// not modified, changes to labelled objects (see LabelConfig) are mapped
+	// back to this Controller using the indexes in index.go. Values loaded
+	// from Secrets are tracked by the redactor to keep them out of events,
+	// logs and status.
+	rd := &redactor{}
+	cfgCtx, cfgSpan := tracing.Tracer().Start(ctx, "LoadConfig")
+	cfg, warnings, err := loadAllConfig(cfgCtx, configReader, rd, &c, &main)
+	cfgSpan.End()
+	if err != nil {
+		err = rd.Error(err)
+		rec.Error = err.Error()
+		return r.configFailed(ctx, log, &main, err)
+	}
+	for _, w := range warnings {
+		r.recorder.Event(&main, corev1.EventTypeWarning, EventReasonOverriddenConfig, w)
+		log.Info("Config key overridden", "warning", w)
+	}
+	if setCondition(main.Object, ConditionTypeConfigLoaded, string(corev1.ConditionTrue), ConditionReasonConfigLoaded, "") {
+		if err := r.client.Status().Update(ctx, &main); err != nil {
+			return ctrl.Result{}, fmt.Errorf("updating main status: %w", err)
 		}
 	}
 
-	tmpl, err := templatefactory.New(c.Spec.Source)
+	tmpl, lang, err := r.templaters.get(ctx, configReader, &c)
 	if err != nil {
+		rec.Error = "Invalid source: " + err.Error()
 		r.recorder.Event(&main, corev1.EventTypeWarning, EventReasonFailedTemplating, "Invalid source: "+err.Error())
 		log.Info("detecting source language", "error", err.Error())
 		return ctrl.Result{}, nil
 	}
 
-	res, err := tmpl.Template(r.client, &template.Input{Object: &main, Config: cfg, Supported: r.supportedDependencies})
+	// Related objects are read like the objects read by templates, so that
+	// changes to them are watched as well.
+	reader := r.templateReader(&c, childClient)
+	relCtx, relSpan := tracing.Tracer().Start(ctx, "LoadRelated")
+	related, err := LoadRelated(relCtx, reader, r.mapper, &c, &main)
+	relSpan.End()
 	if err != nil {
+		r.recordReads(req.NamespacedName, reader)
+		err = rd.Error(err)
+		rec.Error = "Loading related objects: " + err.Error()
+		r.recorder.Event(&main, corev1.EventTypeWarning, EventReasonFailedTemplating, rec.Error)
+		log.Info("loading related objects", "error", err.Error())
+		return ctrl.Result{}, nil
+	}
+
+	tmplCtx, tmplSpan := tracing.Tracer().Start(ctx, "Template", trace.WithAttributes(attribute.String("language", lang)))
+	input := &template.Input{Object: &main, Config: cfg, Supported: r.supportedDependencies, Related: related}
+	rec.Input = redactedCopy(rd, input)
+	start := time.Now()
+	res, err := tmpl.Template(tmplCtx, reader, input)
+	duration := time.Since(start)
+	// Changes to the objects read by the template (even if it failed)
+	// trigger a new render.
+	r.recordReads(req.NamespacedName, reader)
+	templateDuration.WithLabelValues(r.controllerName, lang).Observe(duration.Seconds())
+	tmplSpan.End()
+	rec.Duration = duration.String()
+	if err != nil {
+		templateErrors.WithLabelValues(r.controllerName, lang).Inc()
+		err = rd.Error(err)
+		rec.Error = err.Error()
 		r.recorder.Event(&main, corev1.EventTypeWarning, EventReasonFailedTemplating, err.Error())
 		log.Info("templating resulting in an error", "error", err.Error())
 		return ctrl.Result{}, nil
 	}
 
+	rec.Output = redactedCopy(rd, res)
+
+	// Children that are no longer rendered are dropped from the applied
+	// versions.
+	var prevVersions map[string]string
+	if v, ok := r.childVersions.Load(req.NamespacedName); ok {
+		prevVersions = v.(map[string]string)
+	}
+	versions := make(map[string]string, len(res.Apply))
+	defer r.childVersions.Store(req.NamespacedName, versions)
+
 	var applyFailed bool
 	for _, obj := range res.Apply {
 		log := log.WithValues("kind", obj.GetKind())
+		childDone := func(result string, err error) {
+			observeChildApplied(r.controllerName, obj.GroupVersionKind(), result)
+			rec.addChild(obj, result, rd.Error(err))
+		}
 		publishFailure := func(err error) {
+			childDone(applyResultFailed, err)
+			err = rd.Error(err)
 			r.recorder.Event(&main, corev1.EventTypeWarning, EventReasonFailedApplying, err.Error())
 			log.Info("Apply failed", "error", err.Error())
 		}
@@ -165,12 +267,33 @@ func (r *ControllerCRDReconciler) Reconcile(req ctrl.Request) (ctrl.Result, erro
 			continue
 		}
 
+		// Secret references are only resolved right before applying.
+		if err := rd.Resolve(obj.Object); err != nil {
+			publishFailure(fmt.Errorf("applying %s %s: %w", obj.GetKind(), obj.GetName(), err))
+			continue
+		}
+
 		// FYI: Creating unstructured object will fail without namespacing.
-		// TODO: For cluster scoped resources, check above to see if this can be avoided
-		// by avoiding setting the namespace in the Get for the CRD instance.
 		// NOTE: If the namespace is specified, do not override it.
-		if isNamespaced(obj) && obj.GetNamespace() == "" {
-			obj.SetNamespace(c.Namespace)
+		namespaced, err := r.isNamespaced(obj.GroupVersionKind())
+		if err != nil {
+			publishFailure(fmt.Errorf("applying %s %s: %w", obj.GetKind(), obj.GetName(), err))
+			continue
+		}
+		if namespaced {
+			if obj.GetNamespace() == "" {
+				ns := DefaultChildNamespace(&c, &main)
+				if ns == "" {
+					publishFailure(fmt.Errorf("applying %s %s: namespace must be specified, it is not defaulted by Controller (.spec.namespacePolicy)", obj.GetKind(), obj.GetName()))
+					continue
+				}
+				obj.SetNamespace(ns)
+			}
+
+			if err := r.checkNamespacePolicy(ctx, c.Spec.NamespacePolicy, main.GetNamespace(), obj.GetNamespace()); err != nil {
+				publishFailure(fmt.Errorf("applying %s %s: %w", obj.GetKind(), obj.GetName(), err))
+				continue
+			}
 		}
 
 		// Allow for avoiding ownership references because it can interfere with some
@@ -181,11 +304,13 @@ func (r *ControllerCRDReconciler) Reconcile(req ctrl.Request) (ctrl.Result, erro
 			// Avoid setting any owner references.
 		case AnnotationOwnershipValueNonController:
 			if err := controllerutil.SetOwnerReference(&main, obj, r.scheme); err != nil {
+				childDone(applyResultFailed, err)
 				log.Error(err, "Unable to set owner reference")
 				continue
 			}
 		default:
 			if err := controllerutil.SetControllerReference(&main, obj, r.scheme); err != nil {
+				childDone(applyResultFailed, err)
 				log.Error(err, "Unable to set controller reference")
 				continue
 			}
@@ -217,19 +342,87 @@ func (r *ControllerCRDReconciler) Reconcile(req ctrl.Request) (ctrl.Result, erro
 
 		// Server-side apply
 		// NOTE: This was failing for CAPI CRDs (MachineDeloyment .spec.replicas). Need to retest.
-		if err := r.client.Patch(ctx, obj, client.Apply, client.ForceOwnership, client.FieldOwner(r.name())); err != nil {
-			// problem, _ := json.Marshal(obj)
-			return ctrl.Result{}, fmt.Errorf("applying (server-side apply): %w", err)
+		gvk := obj.GroupVersionKind()
+		applyCtx, applySpan := tracing.Tracer().Start(ctx, "Apply", trace.WithAttributes(
+			attribute.String("gvk", gvk.String()),
+			attribute.String("namespace", obj.GetNamespace()),
+			attribute.String("name", obj.GetName()),
+		))
+		err = childClient.Patch(applyCtx, obj, client.Apply, client.ForceOwnership, client.FieldOwner(r.name()))
+		applySpan.End()
+		if err != nil {
+			// The other children are still applied, the parent is
+			// requeued (see applyFailed).
+			publishFailure(fmt.Errorf("applying (server-side apply): %w", err))
+			applyFailed = true
+			continue
+		}
+
+		childKey := fmt.Sprintf("%s/%s/%s", gvkString(gvk), obj.GetNamespace(), obj.GetName())
+		if prev, ok := prevVersions[childKey]; ok && prev == obj.GetResourceVersion() {
+			childDone(applyResultUnchanged, nil)
+		} else {
+			childDone(applyResultApplied, nil)
 		}
+		versions[childKey] = obj.GetResourceVersion()
 
 		r.recorder.Eventf(&main, corev1.EventTypeNormal, EventReasonApplied, "Successfully applied object %s: %s", obj.GetKind(), obj.GetName())
 		log.Info("Applied object")
 	}
 
+	if res.Object != nil {
+		patch, err := parentPatch(&main, res.Object)
+		if err != nil {
+			err = rd.Error(err)
+			r.recorder.Event(&main, corev1.EventTypeWarning, EventReasonFailedApplying, "Invalid parent update: "+err.Error())
+			log.Info("Invalid parent update", "error", err.Error())
+		} else {
+			log.Info("Applying parent")
+			parentCtx, parentSpan := tracing.Tracer().Start(ctx, "ApplyParent")
+			// Ownership is not forced: fields of the parent that are managed
+			// by someone else (i.e. the user's kubectl apply) are not taken
+			// over, the conflict is reported on the parent instead.
+			err := r.client.Patch(parentCtx, patch, client.Apply, client.FieldOwner(r.parentFieldOwner()))
+			parentSpan.End()
+			if err != nil && !apierrors.IsConflict(err) {
+				return ctrl.Result{}, rd.Error(fmt.Errorf("applying parent (server-side apply): %w", err))
+			}
+			if err != nil {
+				err = rd.Error(err)
+				r.recorder.Event(&main, corev1.EventTypeWarning, EventReasonFailedApplying, "Conflicting parent update: "+err.Error())
+				log.Info("Conflicting parent update", "error", err.Error())
+			} else {
+				// Continue with the latest version of the parent (returned by
+				// the patch) to avoid a conflict when updating the status below.
+				main = *patch
+			}
+			if setParentUpdated(main.Object, err) && res.Status == nil {
+				if err := r.client.Status().Update(ctx, &main); err != nil {
+					return ctrl.Result{}, fmt.Errorf("updating main status: %v", err)
+				}
+			}
+		}
+	}
+
 	if res.Status != nil {
-		main.Object["status"] = res.Status
-		if err := r.client.Status().Update(ctx, &main); err != nil {
-			return ctrl.Result{}, fmt.Errorf("updating main status: %v", err)
+		// The status is replaced by the template, except for the
+		// ConfigLoaded and ParentUpdated conditions (unless the template
+		// sets them).
+		conds := []map[string]interface{}{
+			getCondition(main.Object, ConditionTypeConfigLoaded),
+			getCondition(main.Object, ConditionTypeParentUpdated),
+		}
+		main.Object["status"] = rd.Object(res.Status)
+		for _, cond := range conds {
+			if cond != nil && getCondition(main.Object, cond["type"].(string)) == nil {
+				putCondition(main.Object, cond)
+			}
+		}
+		statusCtx, statusSpan := tracing.Tracer().Start(ctx, "UpdateStatus")
+		err := r.client.Status().Update(statusCtx, &main)
+		statusSpan.End()
+		if err != nil {
+			return ctrl.Result{}, rd.Error(fmt.Errorf("updating main status: %v", err))
 		}
 	}
 
@@ -241,7 +434,42 @@ func (r *ControllerCRDReconciler) Reconcile(req ctrl.Request) (ctrl.Result, erro
 	return ctrl.Result{}, nil
 }
 
-func isNamespaced(u *unstructured.Unstructured) bool {
+// configFailed reports a failure to load config on the parent object.
+// Templating is skipped until the config is fixed, which triggers a new
+// reconcile through the config watches.
+func (r *ControllerCRDReconciler) configFailed(ctx context.Context, log logr.Logger, main *unstructured.Unstructured, err error) (ctrl.Result, error) {
+	configLoadFailures.WithLabelValues(r.controllerName).Inc()
+	r.recorder.Event(main, corev1.EventTypeWarning, EventReasonFailedLoadingConfig, err.Error())
+	log.Info("Loading config failed", "error", err.Error())
+
+	setCondition(main.Object, ConditionTypeConfigLoaded, string(corev1.ConditionFalse), EventReasonFailedLoadingConfig, err.Error())
+	if err := r.client.Status().Update(ctx, main); err != nil {
+		return ctrl.Result{}, fmt.Errorf("updating main status: %v", err)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// DefaultChildNamespace returns the namespace of namespaced children that
+// do not specify a namespace. It is empty when the Controller's namespace
+// policy does not allow children in the namespace of the parent, such
+// children need to specify their namespace.
+func DefaultChildNamespace(c *apiv1.Controller, main *unstructured.Unstructured) string {
+	if p := c.Spec.NamespacePolicy; p != nil {
+		if p.SameNamespace {
+			// Default to the namespace of the parent when children are
+			// allowed in it.
+			return main.GetNamespace()
+		}
+		return ""
+	}
+	return c.Namespace
+}
+
+// IsNamespaced returns true if the object is namespaced. It is a guess for
+// when no REST mapper is available, the reconciler uses the mapper (see
+// isNamespaced).
+func IsNamespaced(u *unstructured.Unstructured) bool {
 	kind := u.GetKind()
 
 	switch kind {
@@ -263,8 +491,20 @@ func (r *ControllerCRDReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
 	r.client = mgr.GetClient()
 	r.scheme = mgr.GetScheme()
+	r.restConfig = mgr.GetConfig()
+	r.mapper = mgr.GetRESTMapper()
+	r.apiReader = mgr.GetAPIReader()
+	r.templaters.access = templaterAccess{children: r.client, mapper: r.mapper, restConfig: r.restConfig}
 	r.recorder = mgr.GetEventRecorderFor(r.controllerName)
 
+	if err := setupInstanceIndexes(context.Background(), mgr, main); err != nil {
+		return fmt.Errorf("setting up indexes: %w", err)
+	}
+
+	if err := metrics.Registry.Register(newInstancesCollector(r.client, r.controllerName, r.mainType)); err != nil {
+		return fmt.Errorf("registering metrics: %w", err)
+	}
+
 	c := ctrl.NewControllerManagedBy(mgr).
 		Named(r.name()).
 		For(main)
@@ -295,38 +535,90 @@ func (r *ControllerCRDReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.enqueueSelfRequests)},
 	)
 
-	// Add watches in for Controller configurations (ConfigMaps & Secrets).
-	// NOTE: This appears to be additive in the case where a Controller also
-	// creates its own ConfigMap/Secret resources as dependents.
-	// These global configuration changes should trigger reconcile loops for
-	// each instance of this Controller.
-	c.Watches(
-		&source.Kind{Type: &corev1.Secret{}},
-		&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.enqueueConfigRequests)},
-	)
+	// Namespaces are matched against the namespace policy of this
+	// Controller, changes to their labels may allow (or disallow) children.
 	c.Watches(
-		&source.Kind{Type: &corev1.ConfigMap{}},
-		&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.enqueueConfigRequests)},
+		&source.Kind{Type: &corev1.Namespace{}},
+		&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.enqueueNamespaceRequests)},
+		builder.WithPredicates(namespaceLabelsChanged),
 	)
 
-	return c.Complete(r)
+	// Add watches in for Controller configurations (ConfigMaps & Secrets).
+	// These global configuration changes should trigger reconcile loops for
+	// each instance of this Controller. Changes to config referenced by a
+	// single instance only trigger a reconcile for that instance.
+	// The underlying informers are shared across Controllers and only watch
+	// labelled config objects (see configwatch.go), events are only mapped
+	// to instances that reference the changed object (see index.go).
+	if r.configInformers != nil {
+		c.Watches(
+			&source.Informer{Informer: r.configInformers.secrets},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: r.enqueueConfigRequests(indexConfigSecret, indexInstanceConfigSecret)},
+		)
+		c.Watches(
+			&source.Informer{Informer: r.configInformers.configMaps},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: r.enqueueConfigRequests(indexConfigConfigMap, indexInstanceConfigConfigMap)},
+		)
+	}
+
+	ctrlr, err := c.Build(r)
+	if err != nil {
+		return err
+	}
+	r.controller = ctrlr
+	return nil
 }
 
 func (r *ControllerCRDReconciler) enqueueSelfRequests(a handler.MapObject) []reconcile.Request {
 	return r.listInstancesToReconcile()
 }
 
-func (r *ControllerCRDReconciler) enqueueConfigRequests(a handler.MapObject) []reconcile.Request {
-	var requests []reconcile.Request
+// enqueueConfigRequests returns a mapper that enqueues all instances of this
+// Controller when the config object is referenced by this Controller, or the
+// instances that reference the config object themselves (as recorded by the
+// given indexes).
+func (r *ControllerCRDReconciler) enqueueConfigRequests(controllerIndex, instanceIndex string) handler.ToRequestsFunc {
+	return func(a handler.MapObject) []reconcile.Request {
+		ctx := context.Background()
+		log := r.Log.WithValues("namespace", a.Meta.GetNamespace(), "name", a.Meta.GetName())
+
+		var list apiv1.ControllerList
+		if err := r.client.List(ctx, &list,
+			client.InNamespace(a.Meta.GetNamespace()),
+			client.MatchingFields{controllerIndex: a.Meta.GetName()},
+		); err != nil {
+			log.Error(err, "Listing Controllers referencing config", "index", controllerIndex)
+			return nil
+		}
 
-	ownRefs := a.Meta.GetOwnerReferences()
-	for _, ref := range ownRefs {
-		if ref.APIVersion == apiv1.GroupVersion.String() && ref.Kind == apiv1.ControllerKind {
-			requests = append(requests, r.listInstancesToReconcile()...)
+		for _, c := range list.Items {
+			if c.Name == r.controllerName {
+				return r.listInstancesToReconcile()
+			}
 		}
-	}
 
-	return requests
+		var instances unstructured.UnstructuredList
+		instances.SetGroupVersionKind(r.mainType)
+		if err := r.client.List(ctx, &instances,
+			client.InNamespace(a.Meta.GetNamespace()),
+			client.MatchingFields{instanceIndex: a.Meta.GetName()},
+		); err != nil {
+			log.Error(err, "Listing instances referencing config", "index", instanceIndex)
+			return nil
+		}
+
+		var requests []reconcile.Request
+		for _, i := range instances.Items {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      i.GetName(),
+					Namespace: i.GetNamespace(),
+				},
+			})
+		}
+
+		return requests
+	}
 }
 
 func (r *ControllerCRDReconciler) listInstancesToReconcile() []reconcile.Request {
@@ -352,12 +644,3 @@ func (r *ControllerCRDReconciler) listInstancesToReconcile() []reconcile.Request
 
 	return requests
 }
-
-// TODO
-func isOwner(obj metav1.Object) bool {
-	refs := obj.GetOwnerReferences()
-	for _, ref := range refs {
-		_ = ref
-	}
-	return false
-}
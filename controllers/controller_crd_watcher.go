@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -16,12 +17,16 @@ import (
 )
 
 // ControllerReconciler watches Controller types and notifies the stop channel when
-// it sees ones it does not know about.
+// it sees ones it does not know about (or ones whose registration changed).
 type ControllerReconciler struct {
 	Log     logr.Logger
 	Restart chan struct{}
 
-	ControllerRegistry map[string]bool
+	// ControllerRegistry maps the names of the registered Controllers to
+	// their registration (see registration).
+	ControllerRegistry map[string]string
+
+	restartOnce sync.Once
 
 	client client.Client
 	scheme *runtime.Scheme
@@ -35,7 +40,7 @@ func (r *ControllerReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			r.Log.Info("previous controller no longer exists, triggering restart")
-			close(r.Restart)
+			r.restart()
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -50,14 +55,24 @@ func (r *ControllerReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 		return ctrl.Result{RequeueAfter: delay}, nil
 	}
 
-	if _, ok := r.ControllerRegistry[con.Name]; !ok {
+	reg, ok := r.ControllerRegistry[con.Name]
+	if !ok {
 		r.Log.Info("found unregistered controller, triggering restart")
-		close(r.Restart)
+		r.restart()
+	} else if reg != registration(con) {
+		// The watches and owner indexes are set up when the manager starts.
+		r.Log.Info("types of registered controller changed, triggering restart")
+		r.restart()
 	}
 
 	return ctrl.Result{}, nil
 }
 
+// restart notifies the stop channel (once).
+func (r *ControllerReconciler) restart() {
+	r.restartOnce.Do(func() { close(r.Restart) })
+}
+
 func (r *ControllerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.client = mgr.GetClient()
 	r.scheme = mgr.GetScheme()
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// existingTypes is a client that finds all parent types (the fake client
+// can not list objects by the kind of the parent).
+type existingTypes struct {
+	client.Client
+}
+
+func (existingTypes) List(context.Context, runtime.Object, ...client.ListOption) error {
+	return nil
+}
+
+func TestControllerReconcilerRestart(t *testing.T) {
+	registered := &apiv1.Controller{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec: apiv1.ControllerSpec{
+			For:          apiv1.ResourceType{APIVersion: "v1", Kind: "ConfigMap"},
+			Dependencies: []apiv1.Dependency{{APIVersion: "v1", Kind: "Service"}},
+		},
+	}
+
+	chart := registered.DeepCopy()
+	chart.Spec.Chart = &apiv1.ChartSource{ConfigMap: "chart"}
+	dependency := registered.DeepCopy()
+	dependency.Spec.Dependencies = append(dependency.Spec.Dependencies, apiv1.Dependency{APIVersion: "v1", Kind: "Secret"})
+	source := registered.DeepCopy()
+	source.Spec.Source = map[string]string{"main.jsonnet": "{}"}
+
+	cases := []struct {
+		name       string
+		controller *apiv1.Controller
+		restart    bool
+	}{
+		{name: "unchanged", controller: registered},
+		{name: "source", controller: source},
+		{name: "chart", controller: chart, restart: true},
+		{name: "dependency", controller: dependency, restart: true},
+		{name: "deleted", restart: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			require.NoError(t, clientgoscheme.AddToScheme(scheme))
+			require.NoError(t, apiv1.AddToScheme(scheme))
+			var objs []runtime.Object
+			if c.controller != nil {
+				objs = append(objs, c.controller.DeepCopy())
+			}
+
+			r := &ControllerReconciler{
+				Log:                ctrl.Log.WithName("watcher"),
+				Restart:            make(chan struct{}),
+				ControllerRegistry: map[string]string{"web": registration(registered)},
+				client:             existingTypes{fake.NewFakeClientWithScheme(scheme, objs...)},
+			}
+			res, err := r.Reconcile(ctrl.Request{NamespacedName: types.NamespacedName{Name: "web"}})
+			require.NoError(t, err)
+			require.Zero(t, res.RequeueAfter)
+
+			select {
+			case <-r.Restart:
+				require.True(t, c.restart, "unexpected restart")
+			default:
+				require.False(t, c.restart, "expected a restart")
+			}
+		})
+	}
+}
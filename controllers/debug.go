@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// RenderDebugPath is the path (on the metrics server) that serves the last
+// render of a parent.
+const RenderDebugPath = "/debug/renders"
+
+// renderRecord holds the result of the last reconcile of a parent.
+// Sensitive values are redacted before being recorded.
+type renderRecord struct {
+	Time time.Time `json:"time"`
+	// Input and Output are the redacted template input and output.
+	Input    interface{}   `json:"input,omitempty"`
+	Output   interface{}   `json:"output,omitempty"`
+	Duration string        `json:"duration,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Children []childResult `json:"children,omitempty"`
+}
+
+// childResult is the result of applying a single child.
+type childResult struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Result     string `json:"result"`
+	Error      string `json:"error,omitempty"`
+}
+
+func (rec *renderRecord) addChild(obj *unstructured.Unstructured, result string, err error) {
+	res := childResult{
+		APIVersion: obj.GetAPIVersion(),
+		Kind:       obj.GetKind(),
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		Result:     result,
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	rec.Children = append(rec.Children, res)
+}
+
+// redactedCopy returns a redacted copy of a value (by round tripping it
+// through JSON). The data of Secrets is redacted as a whole, since it holds
+// the (base64 encoded) values that the redactor does not match.
+func redactedCopy(rd *redactor, v interface{}) interface{} {
+	jsn, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("unable to marshal: %v", err)
+	}
+	var cp interface{}
+	if err := json.Unmarshal(jsn, &cp); err != nil {
+		return fmt.Sprintf("unable to unmarshal: %v", err)
+	}
+	return rd.Object(redactSecrets(cp))
+}
+
+// redactSecrets replaces the data and stringData of all Secrets in an
+// unstructured value (in place).
+func redactSecrets(in interface{}) interface{} {
+	switch v := in.(type) {
+	case []interface{}:
+		for _, elem := range v {
+			redactSecrets(elem)
+		}
+	case map[string]interface{}:
+		if v["apiVersion"] == "v1" && v["kind"] == "Secret" {
+			for _, field := range []string{"data", "stringData"} {
+				if data, ok := v[field].(map[string]interface{}); ok {
+					for key := range data {
+						data[key] = redactedValue
+					}
+				}
+			}
+		}
+		for _, val := range v {
+			redactSecrets(val)
+		}
+	}
+	return in
+}
+
+// RenderRecorder keeps the last render of every parent (per Controller) and
+// serves them over HTTP.
+type RenderRecorder struct {
+	mu      sync.RWMutex
+	records map[string]*renderRecord
+}
+
+func NewRenderRecorder() *RenderRecorder {
+	return &RenderRecorder{records: make(map[string]*renderRecord)}
+}
+
+func renderKey(controller string, parent types.NamespacedName) string {
+	return controller + "/" + parent.String()
+}
+
+func (rr *RenderRecorder) set(controller string, parent types.NamespacedName, rec *renderRecord) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.records[renderKey(controller, parent)] = rec
+}
+
+func (rr *RenderRecorder) delete(controller string, parent types.NamespacedName) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	delete(rr.records, renderKey(controller, parent))
+}
+
+func (rr *RenderRecorder) get(controller string, parent types.NamespacedName) (*renderRecord, bool) {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+	rec, ok := rr.records[renderKey(controller, parent)]
+	return rec, ok
+}
+
+// ServeHTTP serves the last render of a parent as JSON. The parent is
+// selected with the "controller", "namespace" and "name" query parameters.
+func (rr *RenderRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	controller := q.Get("controller")
+	parent := types.NamespacedName{Namespace: q.Get("namespace"), Name: q.Get("name")}
+	if controller == "" || parent.Name == "" {
+		http.Error(w, "query parameters 'controller' and 'name' are required", http.StatusBadRequest)
+		return
+	}
+
+	rec, ok := rr.get(controller, parent)
+	if !ok {
+		http.Error(w, "no render recorded", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(rec); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
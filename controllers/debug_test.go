@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/codeformio/declare/template"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestRenderRecorder(t *testing.T) {
+	rd := &redactor{}
+	rd.add("s3cr3t")
+
+	child := &unstructured.Unstructured{}
+	child.SetAPIVersion("v1")
+	child.SetKind("Service")
+	child.SetNamespace("default")
+	child.SetName("hello")
+
+	rec := &renderRecord{
+		Time:  time.Now(),
+		Input: redactedCopy(rd, &template.Input{Config: map[string]interface{}{"password": "s3cr3t"}}),
+		Output: redactedCopy(rd, &template.Output{Apply: []*unstructured.Unstructured{
+			{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Secret",
+				"metadata":   map[string]interface{}{"name": "hello"},
+				"data":       map[string]interface{}{"password": base64.StdEncoding.EncodeToString([]byte("s3cr3t"))},
+				"stringData": map[string]interface{}{"token": "plain"},
+			}},
+			// Other objects only have the sensitive values redacted.
+			{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]interface{}{"name": "hello"},
+				"data":       map[string]interface{}{"password": "s3cr3t"},
+			}},
+		}}),
+		Duration: "1ms",
+	}
+	rec.addChild(child, applyResultApplied, nil)
+
+	rr := NewRenderRecorder()
+	parent := types.NamespacedName{Namespace: "default", Name: "hello"}
+	rr.set("webservices", parent, rec)
+
+	srv := httptest.NewServer(rr)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?controller=webservices&namespace=default&name=hello")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, "[REDACTED]", body["input"].(map[string]interface{})["config"].(map[string]interface{})["password"])
+	require.Equal(t, "1ms", body["duration"])
+	// The base64 encoded data of Secret children is redacted as a whole.
+	apply := body["output"].(map[string]interface{})["apply"].([]interface{})
+	require.Equal(t, map[string]interface{}{"password": "[REDACTED]"}, apply[0].(map[string]interface{})["data"])
+	require.Equal(t, map[string]interface{}{"token": "[REDACTED]"}, apply[0].(map[string]interface{})["stringData"])
+	require.Equal(t, map[string]interface{}{"password": "[REDACTED]"}, apply[1].(map[string]interface{})["data"])
+	require.Equal(t, []interface{}{map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"namespace":  "default",
+		"name":       "hello",
+		"result":     "applied",
+	}}, body["children"])
+
+	resp, err = http.Get(srv.URL + "?controller=webservices&namespace=default&name=other")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	rr.delete("webservices", parent)
+	resp, err = http.Get(srv.URL + "?controller=webservices&namespace=default&name=hello")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// errServiceAccountRequired is returned for Controllers without a
+// ServiceAccount when the manager requires one.
+var errServiceAccountRequired = errors.New("controller must specify a ServiceAccount (.spec.serviceAccountName)")
+
+// childClient returns the client used to apply and get children of a
+// Controller. When the Controller specifies a ServiceAccount, the returned
+// client impersonates that ServiceAccount, otherwise the manager's client is
+// used (unless a ServiceAccount is required).
+func (r *ControllerCRDReconciler) childClient(c *apiv1.Controller) (client.Client, error) {
+	name := c.Spec.ServiceAccountName
+	if name == "" {
+		if r.requireServiceAccount {
+			return nil, errServiceAccountRequired
+		}
+		return r.client, nil
+	}
+	username := serviceAccountUsername(c)
+
+	r.impersonatedMu.Lock()
+	defer r.impersonatedMu.Unlock()
+
+	if cl, ok := r.impersonated[username]; ok {
+		return cl, nil
+	}
+
+	cl, err := client.New(impersonate(r.restConfig, c), client.Options{Scheme: r.scheme, Mapper: r.mapper})
+	if err != nil {
+		return nil, fmt.Errorf("creating client for %s: %w", username, err)
+	}
+
+	if r.impersonated == nil {
+		r.impersonated = make(map[string]client.Client)
+	}
+	r.impersonated[username] = cl
+
+	return cl, nil
+}
+
+// serviceAccountUsername returns the username of the ServiceAccount of a
+// Controller.
+func serviceAccountUsername(c *apiv1.Controller) string {
+	return fmt.Sprintf("system:serviceaccount:%s:%s", c.Namespace, c.Spec.ServiceAccountName)
+}
+
+// impersonate returns a copy of the config that impersonates the
+// ServiceAccount of a Controller.
+func impersonate(cfg *rest.Config, c *apiv1.Controller) *rest.Config {
+	cfg = rest.CopyConfig(cfg)
+	cfg.Impersonate = rest.ImpersonationConfig{UserName: serviceAccountUsername(c)}
+	return cfg
+}
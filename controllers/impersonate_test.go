@@ -0,0 +1,27 @@
+package controllers
+
+import (
+	"testing"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestChildClientRequireServiceAccount(t *testing.T) {
+	cl := fake.NewFakeClientWithScheme(runtime.NewScheme())
+	c := &apiv1.Controller{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+
+	// Without a ServiceAccount, the manager's client is used.
+	r := &ControllerCRDReconciler{client: cl}
+	child, err := r.childClient(c)
+	require.NoError(t, err)
+	require.Equal(t, cl, child)
+
+	// Unless one is required.
+	r.requireServiceAccount = true
+	_, err = r.childClient(c)
+	require.Equal(t, errServiceAccountRequired, err)
+}
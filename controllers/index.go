@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/codeformio/declare/template"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const (
+	// indexConfigSecret indexes Controllers by the names of the Secrets
+	// referenced in .spec.config.
+	indexConfigSecret = "spec.config.secret"
+	// indexConfigConfigMap indexes Controllers by the names of the ConfigMaps
+	// referenced in .spec.config (and .spec.chart).
+	indexConfigConfigMap = "spec.config.configMap"
+
+	// indexInstanceConfigSecret indexes parent objects by the names of the
+	// Secrets referenced in their config annotation.
+	indexInstanceConfigSecret = "metadata.annotations.config.secret"
+	// indexInstanceConfigConfigMap indexes parent objects by the names of the
+	// ConfigMaps referenced in their config annotation.
+	indexInstanceConfigConfigMap = "metadata.annotations.config.configMap"
+)
+
+// setupIndexes registers the cache indexes that are shared across all
+// Controller reconcilers. This needs to happen once, before the manager is started.
+func setupIndexes(ctx context.Context, mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &apiv1.Controller{}, indexConfigSecret, func(obj runtime.Object) []string {
+		var names []string
+		for _, src := range obj.(*apiv1.Controller).Spec.Config {
+			if src.Secret != "" {
+				names = append(names, src.Secret)
+			}
+		}
+		return names
+	}); err != nil {
+		return fmt.Errorf("indexing controller config secrets: %w", err)
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &apiv1.Controller{}, indexConfigConfigMap, func(obj runtime.Object) []string {
+		var names []string
+		for _, src := range obj.(*apiv1.Controller).Spec.Config {
+			if src.ConfigMap != "" {
+				names = append(names, src.ConfigMap)
+			}
+		}
+		if chart := obj.(*apiv1.Controller).Spec.Chart; chart != nil && chart.ConfigMap != "" {
+			names = append(names, chart.ConfigMap)
+		}
+		return names
+	}); err != nil {
+		return fmt.Errorf("indexing controller config configmaps: %w", err)
+	}
+
+	return nil
+}
+
+// setupInstanceIndexes registers the cache indexes for the parent type of a
+// Controller.
+func setupInstanceIndexes(ctx context.Context, mgr ctrl.Manager, main runtime.Object) error {
+	if err := mgr.GetFieldIndexer().IndexField(ctx, main, indexInstanceConfigSecret, func(obj runtime.Object) []string {
+		var names []string
+		srcs, _ := instanceConfigSources(obj.(metav1.Object))
+		for _, src := range srcs {
+			if src.Secret != "" {
+				names = append(names, src.Secret)
+			}
+		}
+		return names
+	}); err != nil {
+		return fmt.Errorf("indexing instance config secrets: %w", err)
+	}
+
+	if err := mgr.GetFieldIndexer().IndexField(ctx, main, indexInstanceConfigConfigMap, func(obj runtime.Object) []string {
+		var names []string
+		srcs, _ := instanceConfigSources(obj.(metav1.Object))
+		for _, src := range srcs {
+			if src.ConfigMap != "" {
+				names = append(names, src.ConfigMap)
+			}
+		}
+		return names
+	}); err != nil {
+		return fmt.Errorf("indexing instance config configmaps: %w", err)
+	}
+
+	return nil
+}
+
+// setupOwnerIndexes indexes the objects of the given types by the UIDs of
+// their owners (see template.OwnerIndex), to list the children observed by
+// metacontroller webhooks. Every type is only indexed once.
+func setupOwnerIndexes(ctx context.Context, mgr ctrl.Manager, gvks []schema.GroupVersionKind) error {
+	indexed := make(map[schema.GroupVersionKind]bool)
+	for _, gvk := range gvks {
+		if indexed[gvk] {
+			continue
+		}
+		indexed[gvk] = true
+
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		if err := mgr.GetFieldIndexer().IndexField(ctx, obj, template.OwnerIndex, ownerUIDs); err != nil {
+			return fmt.Errorf("indexing owners of %v: %w", gvk, err)
+		}
+	}
+	return nil
+}
+
+func ownerUIDs(obj runtime.Object) []string {
+	var uids []string
+	for _, ref := range obj.(metav1.Object).GetOwnerReferences() {
+		uids = append(uids, string(ref.UID))
+	}
+	return uids
+}
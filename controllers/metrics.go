@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	metricsNamespace = "declare"
+
+	applyResultApplied   = "applied"
+	applyResultUnchanged = "unchanged"
+	applyResultFailed    = "failed"
+)
+
+var (
+	templateDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "template_duration_seconds",
+		Help:      "Duration of template evaluation.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"controller", "language"})
+
+	templateErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "template_errors_total",
+		Help:      "Number of template evaluations that resulted in an error.",
+	}, []string{"controller", "language"})
+
+	templateCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "template_cache_requests_total",
+		Help:      "Number of lookups in the compiled template cache by result (hit or miss).",
+	}, []string{"controller", "result"})
+
+	childrenApplied = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "children_applied_total",
+		Help:      "Number of children applied by result (applied, unchanged or failed).",
+	}, []string{"controller", "group", "version", "kind", "result"})
+
+	configLoadFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "config_load_failures_total",
+		Help:      "Number of times config could not be loaded.",
+	}, []string{"controller"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		templateDuration,
+		templateErrors,
+		templateCacheRequests,
+		childrenApplied,
+		configLoadFailures,
+	)
+}
+
+func observeChildApplied(controller string, gvk schema.GroupVersionKind, result string) {
+	childrenApplied.WithLabelValues(controller, gvk.Group, gvk.Version, gvk.Kind, result).Inc()
+}
+
+// instancesCollector reports the number of instances (parents) of a
+// Controller by the status of their Ready condition. Instances are counted
+// from the cache when metrics are collected.
+type instancesCollector struct {
+	desc       *prometheus.Desc
+	client     client.Reader
+	controller string
+	gvk        schema.GroupVersionKind
+}
+
+func newInstancesCollector(c client.Reader, controller string, gvk schema.GroupVersionKind) *instancesCollector {
+	return &instancesCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "instances"),
+			"Number of instances of a Controller by the status of their Ready condition.",
+			[]string{"ready"},
+			prometheus.Labels{"controller": controller},
+		),
+		client:     c,
+		controller: controller,
+		gvk:        gvk,
+	}
+}
+
+func (c *instancesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *instancesCollector) Collect(ch chan<- prometheus.Metric) {
+	var list unstructured.UnstructuredList
+	list.SetGroupVersionKind(c.gvk)
+	if err := c.client.List(context.Background(), &list); err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, fmt.Errorf("listing instances: %w", err))
+		return
+	}
+
+	counts := map[string]int{"True": 0, "False": 0, "Unknown": 0}
+	for _, item := range list.Items {
+		counts[readyStatus(&item)]++
+	}
+
+	for status, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), status)
+	}
+}
+
+// readyStatus returns the status of the Ready condition of an object,
+// "Unknown" when the condition is not set.
+func readyStatus(obj *unstructured.Unstructured) string {
+	conds, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conds {
+		m, ok := c.(map[string]interface{})
+		if !ok || m["type"] != "Ready" {
+			continue
+		}
+		switch status := m["status"]; status {
+		case "True", "False":
+			return status.(string)
+		}
+	}
+	return "Unknown"
+}
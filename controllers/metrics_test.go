@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestReadyStatus(t *testing.T) {
+	cases := []struct {
+		name   string
+		status map[string]interface{}
+		ready  string
+	}{
+		{name: "noStatus", ready: "Unknown"},
+		{name: "noReadyCondition", status: map[string]interface{}{"conditions": []interface{}{map[string]interface{}{"type": "ConfigLoaded", "status": "False"}}}, ready: "Unknown"},
+		{name: "ready", status: map[string]interface{}{"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "True"}}}, ready: "True"},
+		{name: "notReady", status: map[string]interface{}{"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "False"}}}, ready: "False"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+			if c.status != nil {
+				obj.Object["status"] = c.status
+			}
+			require.Equal(t, c.ready, readyStatus(obj))
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// checkNamespacePolicy returns an error if a child is not allowed in the
+// given namespace according to the Controller's namespace policy.
+func (r *ControllerCRDReconciler) checkNamespacePolicy(ctx context.Context, policy *apiv1.NamespacePolicy, parentNamespace, namespace string) error {
+	if policy == nil {
+		return nil
+	}
+
+	// Only lookup the Namespace when it is needed to match against the
+	// selector.
+	var ns *corev1.Namespace
+	if policy.Selector != nil {
+		ns = &corev1.Namespace{}
+		if err := r.client.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+			if !apierrors.IsNotFound(err) {
+				return fmt.Errorf("getting namespace: %w", err)
+			}
+			ns = nil
+		}
+	}
+
+	allowed, err := namespaceAllowed(policy, parentNamespace, namespace, ns)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("namespace %q is not allowed by Controller (.spec.namespacePolicy)", namespace)
+	}
+
+	return nil
+}
+
+// namespaceAllowed checks a namespace against a namespace policy. The
+// Namespace object is only used for matching against the policy's selector
+// and can be nil if it does not exist.
+func namespaceAllowed(policy *apiv1.NamespacePolicy, parentNamespace, namespace string, ns *corev1.Namespace) (bool, error) {
+	if policy.SameNamespace && namespace == parentNamespace {
+		return true, nil
+	}
+
+	for _, allowed := range policy.Allowed {
+		if allowed == namespace {
+			return true, nil
+		}
+	}
+
+	if policy.Selector != nil && ns != nil {
+		sel, err := metav1.LabelSelectorAsSelector(policy.Selector)
+		if err != nil {
+			return false, fmt.Errorf("parsing namespace policy selector: %w", err)
+		}
+		if sel.Matches(labels.Set(ns.Labels)) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// isNamespaced returns true if objects of the given type are namespaced.
+func (r *ControllerCRDReconciler) isNamespaced(gvk schema.GroupVersionKind) (bool, error) {
+	mapping, err := r.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return false, fmt.Errorf("getting REST mapping: %w", err)
+	}
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
+
+// namespaceLabelsChanged filters Namespace events to the ones that can
+// change the outcome of a namespace policy selector.
+var namespaceLabelsChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return !labels.Equals(e.MetaOld.GetLabels(), e.MetaNew.GetLabels())
+	},
+	DeleteFunc: func(event.DeleteEvent) bool {
+		return false
+	},
+	GenericFunc: func(event.GenericEvent) bool {
+		return false
+	},
+}
+
+// enqueueNamespaceRequests enqueues all instances of this Controller when
+// its namespace policy selects namespaces by label.
+func (r *ControllerCRDReconciler) enqueueNamespaceRequests(a handler.MapObject) []reconcile.Request {
+	var c apiv1.Controller
+	// TODO: Remove hardcoded "default" namespace.
+	if err := r.client.Get(context.Background(), types.NamespacedName{Name: r.controllerName, Namespace: "default"}, &c); err != nil {
+		if !apierrors.IsNotFound(err) {
+			r.Log.Error(err, "Getting Controller for namespace policy", "namespace", a.Meta.GetName())
+		}
+		return nil
+	}
+	if p := c.Spec.NamespacePolicy; p == nil || p.Selector == nil {
+		return nil
+	}
+	return r.listInstancesToReconcile()
+}
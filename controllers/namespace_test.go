@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"testing"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestNamespaceAllowed(t *testing.T) {
+	teamB := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"tenant": "b"}}}
+
+	cases := []struct {
+		name      string
+		policy    apiv1.NamespacePolicy
+		namespace string
+		ns        *corev1.Namespace
+		allowed   bool
+	}{
+		{name: "sameNamespace", policy: apiv1.NamespacePolicy{SameNamespace: true}, namespace: "team-a", allowed: true},
+		{name: "otherNamespace", policy: apiv1.NamespacePolicy{SameNamespace: true}, namespace: "team-b", ns: teamB, allowed: false},
+		{name: "allowList", policy: apiv1.NamespacePolicy{Allowed: []string{"shared", "team-b"}}, namespace: "team-b", allowed: true},
+		{name: "notInAllowList", policy: apiv1.NamespacePolicy{Allowed: []string{"shared"}}, namespace: "team-b", allowed: false},
+		{
+			name:      "selector",
+			policy:    apiv1.NamespacePolicy{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "b"}}},
+			namespace: "team-b",
+			ns:        teamB,
+			allowed:   true,
+		},
+		{
+			name:      "selectorMismatch",
+			policy:    apiv1.NamespacePolicy{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "a"}}},
+			namespace: "team-b",
+			ns:        teamB,
+			allowed:   false,
+		},
+		{
+			name:      "selectorMissingNamespace",
+			policy:    apiv1.NamespacePolicy{Selector: &metav1.LabelSelector{}},
+			namespace: "team-c",
+			allowed:   false,
+		},
+		{
+			name:      "anyRule",
+			policy:    apiv1.NamespacePolicy{SameNamespace: true, Allowed: []string{"shared"}},
+			namespace: "shared",
+			allowed:   true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			allowed, err := namespaceAllowed(&c.policy, "team-a", c.namespace, c.ns)
+			require.NoError(t, err)
+			require.Equal(t, c.allowed, allowed)
+		})
+	}
+}
+
+func TestDefaultChildNamespace(t *testing.T) {
+	var main unstructured.Unstructured
+	main.SetNamespace("team-a")
+
+	cases := []struct {
+		name      string
+		policy    *apiv1.NamespacePolicy
+		namespace string
+	}{
+		{name: "noPolicy", namespace: "default"},
+		{name: "sameNamespace", policy: &apiv1.NamespacePolicy{SameNamespace: true, Allowed: []string{"shared"}}, namespace: "team-a"},
+		// Children need to specify one of the allowed namespaces.
+		{name: "allowedOnly", policy: &apiv1.NamespacePolicy{Allowed: []string{"default"}}, namespace: ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctrl := &apiv1.Controller{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+				Spec:       apiv1.ControllerSpec{NamespacePolicy: c.policy},
+			}
+			require.Equal(t, c.namespace, DefaultChildNamespace(ctrl, &main))
+		})
+	}
+}
+
+func TestIsNamespaced(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+	r := &ControllerCRDReconciler{mapper: mapper}
+
+	namespaced, err := r.isNamespaced(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"})
+	require.NoError(t, err)
+	require.True(t, namespaced)
+
+	namespaced, err = r.isNamespaced(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"})
+	require.NoError(t, err)
+	require.False(t, namespaced)
+
+	_, err = r.isNamespaced(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Unknown"})
+	require.Error(t, err)
+}
+
+func TestNamespaceLabelsChanged(t *testing.T) {
+	old := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"tenant": "b"}}}
+	relabelled := old.DeepCopy()
+	relabelled.Labels["tenant"] = "a"
+	annotated := old.DeepCopy()
+	annotated.Annotations = map[string]string{"note": "unrelated"}
+
+	require.True(t, namespaceLabelsChanged.Update(event.UpdateEvent{MetaOld: old, ObjectOld: old, MetaNew: relabelled, ObjectNew: relabelled}))
+	require.False(t, namespaceLabelsChanged.Update(event.UpdateEvent{MetaOld: old, ObjectOld: old, MetaNew: annotated, ObjectNew: annotated}))
+	require.True(t, namespaceLabelsChanged.Create(event.CreateEvent{Meta: old, Object: old}))
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// parentFieldOwner returns the field manager used when applying templated
+// updates to the parent object. It is kept separate from the field manager
+// used for children so that ownership of parent fields is easy to identify.
+func (r *ControllerCRDReconciler) parentFieldOwner() string {
+	return r.name() + "_parent"
+}
+
+// parentPatch builds a server-side apply patch for the parent from the
+// object returned by a template. Only .metadata.labels, .metadata.annotations
+// and .spec are carried over. An error is returned if the template attempts to
+// change the identity of the parent or sets any other fields.
+func parentPatch(parent, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	if v := obj.GetAPIVersion(); v != "" && v != parent.GetAPIVersion() {
+		return nil, fmt.Errorf("changing parent apiVersion is not allowed: %q", v)
+	}
+	if v := obj.GetKind(); v != "" && v != parent.GetKind() {
+		return nil, fmt.Errorf("changing parent kind is not allowed: %q", v)
+	}
+	if v := obj.GetName(); v != "" && v != parent.GetName() {
+		return nil, fmt.Errorf("changing parent name is not allowed: %q", v)
+	}
+	if v := obj.GetNamespace(); v != "" && v != parent.GetNamespace() {
+		return nil, fmt.Errorf("changing parent namespace is not allowed: %q", v)
+	}
+
+	for field := range obj.Object {
+		switch field {
+		case "apiVersion", "kind", "metadata", "spec":
+		default:
+			return nil, fmt.Errorf("updating parent field %q is not allowed", field)
+		}
+	}
+	if meta, ok := obj.Object["metadata"].(map[string]interface{}); ok {
+		for field := range meta {
+			switch field {
+			case "name", "namespace", "labels", "annotations":
+			default:
+				return nil, fmt.Errorf("updating parent field \"metadata.%s\" is not allowed", field)
+			}
+		}
+	}
+
+	patch := &unstructured.Unstructured{}
+	patch.SetGroupVersionKind(parent.GroupVersionKind())
+	patch.SetName(parent.GetName())
+	patch.SetNamespace(parent.GetNamespace())
+	if labels := obj.GetLabels(); len(labels) > 0 {
+		patch.SetLabels(labels)
+	}
+	if annotations := obj.GetAnnotations(); len(annotations) > 0 {
+		patch.SetAnnotations(annotations)
+	}
+	if spec, ok := obj.Object["spec"]; ok {
+		patch.Object["spec"] = spec
+	}
+
+	return patch, nil
+}
+
+// setParentUpdated sets the ParentUpdated condition of the parent from the
+// result of applying a parent patch. A non-nil error is a conflict with
+// fields of the parent that are managed by someone else. It reports whether
+// the condition changed.
+func setParentUpdated(obj map[string]interface{}, err error) bool {
+	if err != nil {
+		return setCondition(obj, ConditionTypeParentUpdated, string(corev1.ConditionFalse), ConditionReasonParentConflict, err.Error())
+	}
+	return setCondition(obj, ConditionTypeParentUpdated, string(corev1.ConditionTrue), ConditionReasonParentUpdated, "")
+}
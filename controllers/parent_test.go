@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParentPatch(t *testing.T) {
+	parent := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apps.codeform.io/v1alpha1",
+			"kind":       "WebService",
+			"metadata": map[string]interface{}{
+				"name":      "hello",
+				"namespace": "team-a",
+				"labels":    map[string]interface{}{"existing": "label"},
+			},
+			"spec": map[string]interface{}{
+				"port": int64(80),
+			},
+			"status": map[string]interface{}{
+				"healthy": true,
+			},
+		},
+	}
+
+	cases := []struct {
+		name   string
+		obj    map[string]interface{}
+		output map[string]interface{}
+		errors bool
+	}{
+		{
+			name: "spec",
+			obj: map[string]interface{}{
+				"spec": map[string]interface{}{"clusterIP": "10.0.0.1"},
+			},
+			output: map[string]interface{}{
+				"apiVersion": "apps.codeform.io/v1alpha1",
+				"kind":       "WebService",
+				"metadata": map[string]interface{}{
+					"name":      "hello",
+					"namespace": "team-a",
+				},
+				"spec": map[string]interface{}{"clusterIP": "10.0.0.1"},
+			},
+		},
+		{
+			name: "labelsAndAnnotations",
+			obj: map[string]interface{}{
+				"apiVersion": "apps.codeform.io/v1alpha1",
+				"kind":       "WebService",
+				"metadata": map[string]interface{}{
+					"name":        "hello",
+					"labels":      map[string]interface{}{"tier": "web"},
+					"annotations": map[string]interface{}{"port": "8080"},
+				},
+			},
+			output: map[string]interface{}{
+				"apiVersion": "apps.codeform.io/v1alpha1",
+				"kind":       "WebService",
+				"metadata": map[string]interface{}{
+					"name":        "hello",
+					"namespace":   "team-a",
+					"labels":      map[string]interface{}{"tier": "web"},
+					"annotations": map[string]interface{}{"port": "8080"},
+				},
+			},
+		},
+		{name: "changedName", obj: map[string]interface{}{"metadata": map[string]interface{}{"name": "other"}}, errors: true},
+		{name: "changedNamespace", obj: map[string]interface{}{"metadata": map[string]interface{}{"namespace": "team-b"}}, errors: true},
+		{name: "changedKind", obj: map[string]interface{}{"kind": "Service"}, errors: true},
+		{name: "changedAPIVersion", obj: map[string]interface{}{"apiVersion": "v1"}, errors: true},
+		{name: "status", obj: map[string]interface{}{"status": map[string]interface{}{"healthy": false}}, errors: true},
+		{name: "ownerReferences", obj: map[string]interface{}{"metadata": map[string]interface{}{"ownerReferences": []interface{}{}}}, errors: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			patch, err := parentPatch(parent, &unstructured.Unstructured{Object: c.obj})
+			if c.errors {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.output, patch.Object)
+		})
+	}
+}
+
+func TestSetParentUpdated(t *testing.T) {
+	obj := map[string]interface{}{}
+
+	require.True(t, setParentUpdated(obj, errors.New(`Apply failed with 1 conflict: conflict with "kubectl" using apps.codeform.io/v1alpha1: .spec.port`)))
+	cond := getCondition(obj, ConditionTypeParentUpdated)
+	require.Equal(t, "False", cond["status"])
+	require.Equal(t, ConditionReasonParentConflict, cond["reason"])
+	require.Contains(t, cond["message"], `conflict with "kubectl"`)
+
+	require.True(t, setParentUpdated(obj, nil))
+	require.False(t, setParentUpdated(obj, nil))
+	cond = getCondition(obj, ConditionTypeParentUpdated)
+	require.Equal(t, "True", cond["status"])
+	require.Equal(t, ConditionReasonParentUpdated, cond["reason"])
+}
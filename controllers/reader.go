@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// templateReader is the client.Reader that templates read objects with.
+// Objects are read with the child client, lists are served from the
+// manager's cache. As the cache is filled with the permissions of the
+// manager, a SubjectAccessReview checks that the Controller's ServiceAccount
+// is allowed to list the objects first. Without a ServiceAccount, only the
+// types declared by the Controller (as dependencies or related types) can be
+// listed. All reads are recorded so that changes to the objects can be
+// watched (see readIndex).
+type templateReader struct {
+	client.Reader
+
+	cache  client.Reader
+	auth   client.Client
+	scheme *runtime.Scheme
+	mapper meta.RESTMapper
+	// username is empty when the Controller does not specify a
+	// ServiceAccount.
+	username string
+	groups   []string
+	// declared are the types that can be listed without a ServiceAccount.
+	declared map[schema.GroupVersionKind]bool
+
+	mu sync.Mutex
+	// allowed holds the outcome of reviews (for the lifetime of the reader,
+	// a single reconcile).
+	allowed map[authorizationv1.ResourceAttributes]bool
+	reads   []read
+}
+
+// templateReader returns the reader for the templates of a Controller.
+func (r *ControllerCRDReconciler) templateReader(c *apiv1.Controller, childClient client.Reader) *templateReader {
+	tr := &templateReader{
+		Reader: childClient,
+		cache:  r.client,
+		auth:   r.client,
+		scheme: r.scheme,
+		mapper: r.mapper,
+	}
+	tr.declared = make(map[schema.GroupVersionKind]bool)
+	for _, d := range c.Spec.Dependencies {
+		tr.declared[schema.FromAPIVersionAndKind(d.APIVersion, d.Kind)] = true
+	}
+	for _, rel := range c.Spec.Related {
+		tr.declared[schema.FromAPIVersionAndKind(rel.APIVersion, rel.Kind)] = true
+	}
+	if name := c.Spec.ServiceAccountName; name != "" {
+		tr.username = serviceAccountUsername(c)
+		tr.groups = []string{"system:serviceaccounts", "system:serviceaccounts:" + c.Namespace, "system:authenticated"}
+	}
+	return tr
+}
+
+// Get implements client.Reader.
+func (tr *templateReader) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	gvk, err := apiutil.GVKForObject(obj, tr.scheme)
+	if err != nil {
+		return err
+	}
+	// Objects that do not exist (yet) are recorded as well.
+	tr.record(read{gvk: gvk, namespace: key.Namespace, name: key.Name})
+
+	return tr.Reader.Get(ctx, key, obj)
+}
+
+// List implements client.Reader.
+func (tr *templateReader) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	gvk, err := apiutil.GVKForObject(list, tr.scheme)
+	if err != nil {
+		return err
+	}
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+	var lo client.ListOptions
+	lo.ApplyOptions(opts)
+	tr.record(read{gvk: gvk, namespace: lo.Namespace, selector: lo.LabelSelector})
+
+	if tr.username == "" {
+		if !tr.declared[gvk] {
+			return apierrors.NewForbidden(schema.GroupResource{Group: gvk.Group, Resource: gvk.Kind}, "",
+				fmt.Errorf("listing %s requires it to be declared in .spec.dependencies or .spec.related, or a ServiceAccount (.spec.serviceAccountName)", gvk.Kind))
+		}
+	} else if err := tr.authorize(ctx, gvk, lo.Namespace); err != nil {
+		return err
+	}
+	return tr.cache.List(ctx, list, opts...)
+}
+
+func (tr *templateReader) record(rd read) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.reads = append(tr.reads, rd)
+}
+
+// recorded returns the reads so far.
+func (tr *templateReader) recorded() []read {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return tr.reads
+}
+
+func (tr *templateReader) authorize(ctx context.Context, gvk schema.GroupVersionKind, namespace string) error {
+	mapping, err := tr.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return err
+	}
+
+	attrs := authorizationv1.ResourceAttributes{
+		Namespace: namespace,
+		Verb:      "list",
+		Group:     gvk.Group,
+		Version:   gvk.Version,
+		Resource:  mapping.Resource.Resource,
+	}
+
+	tr.mu.Lock()
+	allowed, ok := tr.allowed[attrs]
+	tr.mu.Unlock()
+	if !ok {
+		review := &authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				User:               tr.username,
+				Groups:             tr.groups,
+				ResourceAttributes: &attrs,
+			},
+		}
+		if err := tr.auth.Create(ctx, review); err != nil {
+			return fmt.Errorf("reviewing access: %w", err)
+		}
+		allowed = review.Status.Allowed
+
+		tr.mu.Lock()
+		if tr.allowed == nil {
+			tr.allowed = make(map[authorizationv1.ResourceAttributes]bool)
+		}
+		tr.allowed[attrs] = allowed
+		tr.mu.Unlock()
+	}
+
+	if !allowed {
+		return apierrors.NewForbidden(schema.GroupResource{Group: gvk.Group, Resource: attrs.Resource}, "",
+			fmt.Errorf("%s can not list objects in namespace %q", tr.username, attrs.Namespace))
+	}
+	return nil
+}
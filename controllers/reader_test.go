@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/codeformio/declare/template"
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// reviewer answers SubjectAccessReviews, allowing lists in the "allowed"
+// namespace only.
+type reviewer struct {
+	client.Client
+	reviews int
+}
+
+func (r *reviewer) Create(_ context.Context, obj runtime.Object, _ ...client.CreateOption) error {
+	review := obj.(*authorizationv1.SubjectAccessReview)
+	r.reviews++
+	review.Status.Allowed = review.Spec.ResourceAttributes.Namespace == "allowed"
+	return nil
+}
+
+func TestTemplateReaderList(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	cache := fake.NewFakeClientWithScheme(scheme,
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "allowed"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "denied"}},
+	)
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+
+	t.Run("noServiceAccount", func(t *testing.T) {
+		auth := &reviewer{}
+		declared := map[schema.GroupVersionKind]bool{corev1.SchemeGroupVersion.WithKind("Secret"): true}
+		tr := &templateReader{cache: cache, auth: auth, scheme: scheme, mapper: mapper, declared: declared}
+		objs, err := template.ListObjects(context.Background(), tr, "v1", "Secret", "", "")
+		require.NoError(t, err)
+		require.Len(t, objs, 2)
+		require.Equal(t, 0, auth.reviews)
+	})
+
+	t.Run("noServiceAccountUndeclared", func(t *testing.T) {
+		auth := &reviewer{}
+		tr := &templateReader{cache: cache, auth: auth, scheme: scheme, mapper: mapper}
+		_, err := template.ListObjects(context.Background(), tr, "v1", "Secret", "allowed", "")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "forbidden")
+		require.Equal(t, 0, auth.reviews)
+	})
+
+	t.Run("serviceAccount", func(t *testing.T) {
+		auth := &reviewer{}
+		tr := &templateReader{cache: cache, auth: auth, scheme: scheme, mapper: mapper, username: "system:serviceaccount:default:web"}
+
+		for i := 0; i < 2; i++ {
+			objs, err := template.ListObjects(context.Background(), tr, "v1", "Secret", "allowed", "")
+			require.NoError(t, err)
+			require.Len(t, objs, 1)
+		}
+		// Reviews are reused.
+		require.Equal(t, 1, auth.reviews)
+
+		_, err := template.ListObjects(context.Background(), tr, "v1", "Secret", "denied", "")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "forbidden")
+		_, err = template.ListObjects(context.Background(), tr, "v1", "Secret", "", "")
+		require.Error(t, err)
+	})
+}
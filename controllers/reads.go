@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// read is an object (or list of objects) that a template read while
+// rendering a parent.
+type read struct {
+	gvk       schema.GroupVersionKind
+	namespace string
+	// name is empty for lists.
+	name     string
+	selector labels.Selector
+}
+
+// matches returns true if a change to the object could change the result of
+// the read. Cluster scoped objects match any namespace (getObject defaults
+// the namespace).
+func (rd read) matches(namespace, name string, lbls map[string]string) bool {
+	if rd.namespace != "" && namespace != "" && rd.namespace != namespace {
+		return false
+	}
+	if rd.name != "" {
+		return rd.name == name
+	}
+	return rd.selector == nil || rd.selector.Matches(labels.Set(lbls))
+}
+
+// readIndex is a reverse index from the objects read by templates to the
+// parents that read them. The reads of a parent are replaced on every
+// render.
+type readIndex struct {
+	mu sync.RWMutex
+	// reads is keyed by the type of the object that was read.
+	reads map[schema.GroupVersionKind]map[types.NamespacedName][]read
+}
+
+// set replaces the reads of a parent.
+func (ri *readIndex) set(parent types.NamespacedName, reads []read) {
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+
+	for gvk, parents := range ri.reads {
+		delete(parents, parent)
+		if len(parents) == 0 {
+			delete(ri.reads, gvk)
+		}
+	}
+	for _, rd := range reads {
+		if ri.reads == nil {
+			ri.reads = make(map[schema.GroupVersionKind]map[types.NamespacedName][]read)
+		}
+		if ri.reads[rd.gvk] == nil {
+			ri.reads[rd.gvk] = make(map[types.NamespacedName][]read)
+		}
+		ri.reads[rd.gvk][parent] = append(ri.reads[rd.gvk][parent], rd)
+	}
+}
+
+// delete removes the reads of a parent.
+func (ri *readIndex) delete(parent types.NamespacedName) {
+	ri.set(parent, nil)
+}
+
+// parents returns the parents that read an object.
+func (ri *readIndex) parents(gvk schema.GroupVersionKind, namespace, name string, lbls map[string]string) []types.NamespacedName {
+	ri.mu.RLock()
+	defer ri.mu.RUnlock()
+
+	var parents []types.NamespacedName
+	for parent, reads := range ri.reads[gvk] {
+		for _, rd := range reads {
+			if rd.matches(namespace, name, lbls) {
+				parents = append(parents, parent)
+				break
+			}
+		}
+	}
+	return parents
+}
+
+// recordReads replaces the reads of a parent with the reads of a reader and
+// watches them.
+func (r *ControllerCRDReconciler) recordReads(parent types.NamespacedName, tr *templateReader) {
+	reads := tr.recorded()
+	r.reads.set(parent, reads)
+	r.watchReads(reads)
+}
+
+// watchReads makes sure that changes to the types of the given reads
+// enqueue the parents that read them. Watches are only added (once per
+// type) and never removed. Secrets and ConfigMaps are watched with the
+// config informers (see readSource).
+func (r *ControllerCRDReconciler) watchReads(reads []read) {
+	if r.controller == nil {
+		return
+	}
+
+	r.readWatchesMu.Lock()
+	defer r.readWatchesMu.Unlock()
+
+	for _, rd := range reads {
+		if r.readWatches[rd.gvk] {
+			continue
+		}
+
+		gvk := rd.gvk
+		src := r.readSource(gvk)
+		if src == nil {
+			continue
+		}
+		if err := r.controller.Watch(
+			src,
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(func(a handler.MapObject) []reconcile.Request {
+				var reqs []reconcile.Request
+				for _, parent := range r.reads.parents(gvk, a.Meta.GetNamespace(), a.Meta.GetName(), a.Meta.GetLabels()) {
+					reqs = append(reqs, reconcile.Request{NamespacedName: parent})
+				}
+				return reqs
+			})},
+		); err != nil {
+			r.Log.Error(err, "Starting watch for objects read by templates", "gvk", gvk.String())
+			continue
+		}
+		r.Log.Info("Started watch for objects read by templates", "gvk", gvk.String())
+
+		if r.readWatches == nil {
+			r.readWatches = make(map[schema.GroupVersionKind]bool)
+		}
+		r.readWatches[gvk] = true
+	}
+}
+
+// readSource returns the source of the events for objects of a type read by
+// templates. The manager's cache would list and watch all Secrets and
+// ConfigMaps in the cluster, so they are only watched when labelled as
+// config (with the label filtered config informers, see configwatch.go).
+// Nil is returned when the type can not be watched.
+func (r *ControllerCRDReconciler) readSource(gvk schema.GroupVersionKind) source.Source {
+	if gvk.Group == "" && gvk.Version == "v1" && (gvk.Kind == "Secret" || gvk.Kind == "ConfigMap") {
+		if r.configInformers == nil {
+			return nil
+		}
+		if gvk.Kind == "Secret" {
+			return &source.Informer{Informer: r.configInformers.secrets}
+		}
+		return &source.Informer{Informer: r.configInformers.configMaps}
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	return &source.Kind{Type: obj}
+}
@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/codeformio/declare/template"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+func TestReadIndex(t *testing.T) {
+	secret := schema.GroupVersionKind{Version: "v1", Kind: "Secret"}
+	node := schema.GroupVersionKind{Version: "v1", Kind: "Node"}
+	a := types.NamespacedName{Namespace: "default", Name: "a"}
+	b := types.NamespacedName{Namespace: "default", Name: "b"}
+
+	var ri readIndex
+	ri.set(a, []read{
+		{gvk: secret, namespace: "default", name: "tls"},
+		{gvk: node, namespace: "default", name: "node-1"},
+	})
+	ri.set(b, []read{
+		{gvk: secret, namespace: "default", selector: labels.SelectorFromSet(labels.Set{"team": "web"})},
+	})
+
+	require.Equal(t, []types.NamespacedName{a}, ri.parents(secret, "default", "tls", nil))
+	require.Empty(t, ri.parents(secret, "other", "tls", nil))
+	require.Equal(t, []types.NamespacedName{b}, ri.parents(secret, "default", "other", map[string]string{"team": "web"}))
+	require.ElementsMatch(t, []types.NamespacedName{a, b}, ri.parents(secret, "default", "tls", map[string]string{"team": "web"}))
+	// Cluster scoped objects match the defaulted namespace.
+	require.Equal(t, []types.NamespacedName{a}, ri.parents(node, "", "node-1", nil))
+
+	// Reads are replaced on every render.
+	ri.set(a, []read{{gvk: secret, namespace: "default", name: "other"}})
+	require.Empty(t, ri.parents(secret, "default", "tls", nil))
+	require.Empty(t, ri.parents(node, "", "node-1", nil))
+	require.Equal(t, []types.NamespacedName{a}, ri.parents(secret, "default", "other", nil))
+
+	ri.delete(a)
+	ri.delete(b)
+	require.Empty(t, ri.reads)
+}
+
+func TestTemplateReaderRecords(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	cl := fake.NewFakeClientWithScheme(scheme, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "default"}})
+	declared := map[schema.GroupVersionKind]bool{corev1.SchemeGroupVersion.WithKind("Secret"): true}
+	tr := &templateReader{Reader: cl, cache: cl, scheme: scheme, declared: declared}
+
+	ctx := context.Background()
+	_, err := template.GetObject(ctx, tr, map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "missing"},
+	})
+	require.NoError(t, err)
+	_, err = template.ListObjects(ctx, tr, "v1", "Secret", "default", "team=web")
+	require.NoError(t, err)
+
+	reads := tr.recorded()
+	require.Len(t, reads, 2)
+	require.Equal(t, read{gvk: schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, namespace: "default", name: "missing"}, reads[0])
+	require.Equal(t, "default", reads[1].namespace)
+	require.Equal(t, "team=web", reads[1].selector.String())
+}
+
+func TestReadSource(t *testing.T) {
+	secret := corev1.SchemeGroupVersion.WithKind("Secret")
+	configMap := corev1.SchemeGroupVersion.WithKind("ConfigMap")
+	service := corev1.SchemeGroupVersion.WithKind("Service")
+
+	// Secrets and ConfigMaps are not watched without the config informers.
+	var r ControllerCRDReconciler
+	require.Nil(t, r.readSource(secret))
+	require.Nil(t, r.readSource(configMap))
+
+	r.configInformers = newConfigInformers(nil)
+	require.Equal(t, &source.Informer{Informer: r.configInformers.secrets}, r.readSource(secret))
+	require.Equal(t, &source.Informer{Informer: r.configInformers.configMaps}, r.readSource(configMap))
+
+	// Other types are watched with the manager's cache.
+	src, ok := r.readSource(service).(*source.Kind)
+	require.True(t, ok)
+	require.Equal(t, service, src.Type.GetObjectKind().GroupVersionKind())
+}
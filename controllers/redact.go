@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// redactedValue replaces sensitive values in events, logs and status.
+	redactedValue = "[REDACTED]"
+
+	// minRedactLength is the minimum length of a sensitive value for it to be
+	// redacted. Redacting shorter values (i.e. "1") would make most messages
+	// unreadable.
+	minRedactLength = 4
+)
+
+// redactor keeps track of sensitive values (loaded from Secrets) during a
+// reconcile to keep them out of events, logs and status. It also resolves
+// secret references that were passed to templates in place of the values.
+type redactor struct {
+	sensitive  []string
+	references map[string]string
+	// nonce tags the secret references of a reconcile, so that only the
+	// references that were passed to templates are resolved (and not the
+	// ones written by users, i.e. in the spec of the parent).
+	nonce string
+}
+
+// add records a value as sensitive.
+func (r *redactor) add(value string) {
+	if len(value) < minRedactLength {
+		return
+	}
+	for _, v := range r.sensitive {
+		if v == value {
+			return
+		}
+	}
+	r.sensitive = append(r.sensitive, value)
+	// Replace longer values first in case one value contains another.
+	sort.Slice(r.sensitive, func(i, j int) bool {
+		return len(r.sensitive[i]) > len(r.sensitive[j])
+	})
+}
+
+// addReference records the value that a secret reference resolves to.
+func (r *redactor) addReference(ref, value string) {
+	if r.references == nil {
+		r.references = make(map[string]string)
+	}
+	r.references[ref] = value
+	r.add(value)
+}
+
+// String redacts all sensitive values in a string.
+func (r *redactor) String(s string) string {
+	for _, v := range r.sensitive {
+		s = strings.ReplaceAll(s, v, redactedValue)
+	}
+	return s
+}
+
+// Error returns an error with a redacted message. The original error is not
+// wrapped because it would still expose the sensitive values.
+func (r *redactor) Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if redacted := r.String(msg); redacted != msg {
+		return errors.New(redacted)
+	}
+	return err
+}
+
+// Object redacts all sensitive values in the strings of an unstructured
+// object (in place).
+func (r *redactor) Object(obj interface{}) interface{} {
+	return walkStrings(obj, r.String)
+}
+
+// Resolve replaces secret references with their values in the strings of
+// an unstructured object (in place). References that are not tagged with
+// the nonce of the redactor are left as is, an error is returned for
+// tagged references that are unknown.
+func (r *redactor) Resolve(obj interface{}) error {
+	if r.nonce == "" {
+		return nil
+	}
+	prefix := secretReferencePrefix + r.nonce + ":"
+	var err error
+	walkStrings(obj, func(s string) string {
+		var b strings.Builder
+		for {
+			i := strings.Index(s, prefix)
+			if i < 0 {
+				break
+			}
+			j := strings.Index(s[i:], ")")
+			if j < 0 {
+				break
+			}
+			ref := s[i : i+j+1]
+			v, ok := r.references[ref]
+			if !ok {
+				if err == nil {
+					err = fmt.Errorf("unknown secret reference %q", ref)
+				}
+				v = ref
+			}
+			b.WriteString(s[:i])
+			b.WriteString(v)
+			s = s[i+j+1:]
+		}
+		b.WriteString(s)
+		return b.String()
+	})
+	return err
+}
+
+const secretReferencePrefix = "$(secret:"
+
+// reference returns the placeholder that is passed to templates in place
+// of a Secret value. Placeholders are resolved when children are applied.
+func (r *redactor) reference(namespace, name, key string) string {
+	if r.nonce == "" {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			panic(fmt.Sprintf("generating nonce: %v", err))
+		}
+		r.nonce = hex.EncodeToString(b)
+	}
+	return fmt.Sprintf("%s%s:%s/%s/%s)", secretReferencePrefix, r.nonce, namespace, name, key)
+}
+
+func walkStrings(in interface{}, fn func(string) string) interface{} {
+	switch v := in.(type) {
+	case string:
+		return fn(v)
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = walkStrings(elem, fn)
+		}
+	case map[string]interface{}:
+		for key, val := range v {
+			v[key] = walkStrings(val, fn)
+		}
+	}
+	return in
+}
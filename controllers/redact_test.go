@@ -0,0 +1,63 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor(t *testing.T) {
+	rd := &redactor{}
+	rd.add("abc")
+	rd.add("s3cr3t")
+	rd.add("s3cr3t-password")
+	ref := rd.reference("default", "creds", "token")
+	rd.addReference(ref, "t0k3n")
+
+	require.Equal(t, "value: [REDACTED], abc", rd.String("value: s3cr3t-password, abc"))
+	require.Equal(t, "token [REDACTED]", rd.Error(errors.New("token t0k3n")).Error())
+
+	err := errors.New("nothing sensitive")
+	require.Equal(t, err, rd.Error(err))
+
+	status := map[string]interface{}{
+		"message": "connected with s3cr3t",
+		"list":    []interface{}{"t0k3n", int64(1)},
+	}
+	require.Equal(t, map[string]interface{}{
+		"message": "connected with [REDACTED]",
+		"list":    []interface{}{"[REDACTED]", int64(1)},
+	}, rd.Object(status))
+
+	child := map[string]interface{}{
+		"stringData": map[string]interface{}{
+			"token": ref,
+			"url":   "https://" + ref + "@example.com",
+		},
+	}
+	require.NoError(t, rd.Resolve(child))
+	require.Equal(t, map[string]interface{}{
+		"stringData": map[string]interface{}{
+			"token": "t0k3n",
+			"url":   "https://t0k3n@example.com",
+		},
+	}, child)
+
+	// References that are not tagged with the nonce of the render (i.e.
+	// written by a tenant in the parent's spec and copied by the template)
+	// are not resolved.
+	tenant := map[string]interface{}{
+		"token": "$(secret:default/creds/token)",
+		"other": "$(secret:" + rd.nonce + "x:default/creds/token)",
+	}
+	require.NoError(t, rd.Resolve(tenant))
+	require.Equal(t, map[string]interface{}{
+		"token": "$(secret:default/creds/token)",
+		"other": "$(secret:" + rd.nonce + "x:default/creds/token)",
+	}, tenant)
+
+	// Tagged references that were not passed to the template are rejected.
+	unknown := map[string]interface{}{"token": "$(secret:" + rd.nonce + ":default/creds/missing)"}
+	require.Error(t, rd.Resolve(unknown))
+}
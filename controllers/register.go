@@ -2,40 +2,85 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"strings"
 
 	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/codeformio/declare/template"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func Register(ctx context.Context, cl client.Client, mgr ctrl.Manager, stop chan struct{}) error {
+// Options configures the reconcilers of all Controllers.
+type Options struct {
+	// RequireServiceAccount rejects Controllers that do not specify a
+	// ServiceAccount to impersonate, instead of using the permissions of
+	// the manager for them.
+	RequireServiceAccount bool
+}
+
+func Register(ctx context.Context, cl client.Client, mgr ctrl.Manager, stop chan struct{}, opts Options) error {
 	controllers, err := getControllers(ctx, cl)
 	if err != nil {
 		return fmt.Errorf("getting controllers: %w", err)
 	}
 
-	controllerNames := map[string]bool{}
+	registered := map[string]string{}
+	for _, c := range controllers {
+		registered[c.controllerName] = c.registration
+	}
+
+	if err := setupIndexes(ctx, mgr); err != nil {
+		return fmt.Errorf("setting up indexes: %w", err)
+	}
+
+	var observed []schema.GroupVersionKind
 	for _, c := range controllers {
-		controllerNames[c.controllerName] = true
+		if c.observesChildren {
+			for _, gvk := range c.dependentTypes {
+				if c.supportedDependencies[gvkString(gvk)] {
+					observed = append(observed, gvk)
+				}
+			}
+		}
+	}
+	if err := setupOwnerIndexes(ctx, mgr, observed); err != nil {
+		return fmt.Errorf("setting up owner indexes: %w", err)
 	}
 
 	if err := (&ControllerReconciler{
 		Log:                ctrl.Log.WithName("controllers").WithName("ControllerCRD"),
 		Restart:            stop,
-		ControllerRegistry: controllerNames,
+		ControllerRegistry: registered,
 	}).SetupWithManager(mgr); err != nil {
 		return fmt.Errorf("setting up custom site watcher: %w", err)
 	}
 
+	coreClient, err := corev1client.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return fmt.Errorf("creating core client: %w", err)
+	}
+	configInformers := newConfigInformers(coreClient.RESTClient())
+	if err := mgr.Add(configInformers); err != nil {
+		return fmt.Errorf("adding config informers: %w", err)
+	}
+
+	renders := NewRenderRecorder()
+	if err := mgr.AddMetricsExtraHandler(RenderDebugPath, renders); err != nil {
+		return fmt.Errorf("adding render debug handler: %w", err)
+	}
+
 	for _, c := range controllers {
 		r := ControllerCRDReconciler{
-			Log:            ctrl.Log.WithName("controllers").WithName(c.mainType.Kind + "Controller"),
-			controllerInfo: c,
+			Log:                   ctrl.Log.WithName("controllers").WithName(c.mainType.Kind + "Controller"),
+			controllerInfo:        c,
+			configInformers:       configInformers,
+			requireServiceAccount: opts.RequireServiceAccount,
+			renders:               renders,
 		}
 		if err := r.SetupWithManager(mgr); err != nil {
 			return fmt.Errorf("setting up controller crd reconciler for Kind=%v: %w", c.mainType.Kind, err)
@@ -51,10 +96,35 @@ type controllerInfo struct {
 	dependentTypes        []schema.GroupVersionKind
 	supportedDependencies map[string]bool
 	watchedDependencies   map[string]bool
+	// observesChildren is set for Controllers that list the children of
+	// parents: metacontroller webhooks and charts (to tell an upgrade from
+	// an install).
+	observesChildren bool
+	// registration is the part of the spec that the reconciler is set up
+	// with (see registration).
+	registration string
+}
+
+// observesChildren returns true if a Controller lists the children of its
+// parents, which needs the owner index of the dependencies.
+func observesChildren(c *apiv1.Controller) bool {
+	return c.Spec.Chart != nil || c.Spec.Webhook != nil && c.Spec.Webhook.Format == apiv1.WebhookFormatMetacontroller
+}
+
+// registration encodes the fields of a Controller that its reconciler (the
+// watches and the owner indexes) is set up with when the manager starts. The
+// manager restarts when they change.
+func registration(c *apiv1.Controller) string {
+	jsn, _ := json.Marshal(struct {
+		For              apiv1.ResourceType `json:"for"`
+		Dependencies     []apiv1.Dependency `json:"dependencies"`
+		ObservesChildren bool               `json:"observesChildren"`
+	}{c.Spec.For, c.Spec.Dependencies, observesChildren(c)})
+	return string(jsn)
 }
 
 func gvkString(gvk schema.GroupVersionKind) string {
-	return strings.ToLower(fmt.Sprintf("%s.%s.%s", gvk.Kind, gvk.Version, gvk.Group))
+	return template.SupportedKey(gvk)
 }
 
 func getControllers(ctx context.Context, cl client.Client) ([]controllerInfo, error) {
@@ -65,12 +135,15 @@ func getControllers(ctx context.Context, cl client.Client) ([]controllerInfo, er
 
 	var controllers []controllerInfo
 
-	for _, c := range ctrlList.Items {
+	for i := range ctrlList.Items {
+		c := &ctrlList.Items[i]
 		info := controllerInfo{
 			controllerName:        c.Name,
 			mainType:              schema.FromAPIVersionAndKind(c.Spec.For.APIVersion, c.Spec.For.Kind),
 			supportedDependencies: make(map[string]bool),
 			watchedDependencies:   make(map[string]bool),
+			observesChildren:      observesChildren(c),
+			registration:          registration(c),
 		}
 
 		if err := resourceTypeExists(ctx, cl, info.mainType); err != nil {
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	gotemplate "text/template"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/codeformio/declare/template"
+	gotmpl "github.com/codeformio/declare/template/gotemplate"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// LoadRelated reads the related objects of a Controller for a parent (see
+// template.Input.Related). The mapper is used to ignore the namespace of
+// cluster scoped types, namespaces are used as is without a mapper.
+func LoadRelated(ctx context.Context, r client.Reader, mapper meta.RESTMapper, c *apiv1.Controller, parent *unstructured.Unstructured) (map[string]map[string]*unstructured.Unstructured, error) {
+	if len(c.Spec.Related) == 0 {
+		return nil, nil
+	}
+
+	related := make(map[string]map[string]*unstructured.Unstructured)
+	for i, rel := range c.Spec.Related {
+		gvk := schema.FromAPIVersionAndKind(rel.APIVersion, rel.Kind)
+		key := template.RelatedKey(gvk)
+		if related[key] == nil {
+			related[key] = make(map[string]*unstructured.Unstructured)
+		}
+
+		objs, err := loadRelated(ctx, r, mapper, gvk, rel, parent)
+		if err != nil {
+			return nil, fmt.Errorf("related[%d] (%s): %w", i, key, err)
+		}
+		for _, obj := range objs {
+			related[key][template.RelatedName(obj, parent.GetNamespace())] = obj
+		}
+	}
+	return related, nil
+}
+
+func loadRelated(ctx context.Context, r client.Reader, mapper meta.RESTMapper, gvk schema.GroupVersionKind, rel apiv1.Related, parent *unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	// The namespace is not rendered: a parent could otherwise read objects
+	// (i.e. Secrets) in any namespace that the Controller can read.
+	if strings.Contains(rel.Namespace, "{{") {
+		return nil, fmt.Errorf("namespace can not be a template, it defaults to the namespace of the parent")
+	}
+	namespace := rel.Namespace
+	if namespace == "" {
+		namespace = parent.GetNamespace()
+	}
+	if mapper != nil {
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, err
+		}
+		if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+			namespace = ""
+		}
+	}
+
+	switch {
+	case rel.Name != "" && rel.LabelSelector != nil:
+		return nil, fmt.Errorf("only one of name and labelSelector can be specified")
+
+	case rel.Name != "":
+		name, err := renderRelated(rel.Name, parent)
+		if err != nil {
+			return nil, fmt.Errorf("name: %w", err)
+		}
+		if name == "" {
+			return nil, nil
+		}
+
+		var obj unstructured.Unstructured
+		obj.SetGroupVersionKind(gvk)
+		if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &obj); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("getting %q: %w", name, err)
+		}
+		return []*unstructured.Unstructured{&obj}, nil
+
+	case rel.LabelSelector != nil:
+		var err error
+		ls := rel.LabelSelector.DeepCopy()
+		for k, v := range ls.MatchLabels {
+			if ls.MatchLabels[k], err = renderRelated(v, parent); err != nil {
+				return nil, fmt.Errorf("labelSelector: %w", err)
+			}
+		}
+		for i := range ls.MatchExpressions {
+			for j, v := range ls.MatchExpressions[i].Values {
+				if ls.MatchExpressions[i].Values[j], err = renderRelated(v, parent); err != nil {
+					return nil, fmt.Errorf("labelSelector: %w", err)
+				}
+			}
+		}
+		selector, err := metav1.LabelSelectorAsSelector(ls)
+		if err != nil {
+			return nil, fmt.Errorf("labelSelector: %w", err)
+		}
+
+		var list unstructured.UnstructuredList
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := r.List(ctx, &list, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return nil, fmt.Errorf("listing: %w", err)
+		}
+		objs := make([]*unstructured.Unstructured, len(list.Items))
+		for i := range list.Items {
+			objs[i] = &list.Items[i]
+		}
+		return objs, nil
+
+	default:
+		return nil, fmt.Errorf("name or labelSelector must be specified")
+	}
+}
+
+// renderRelated renders a value of a related type with the parent object as
+// data (with the same Sprig functions as Go templates). Missing values render
+// as an empty string.
+func renderRelated(value string, parent *unstructured.Unstructured) (string, error) {
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+
+	tmpl, err := gotemplate.New("").Funcs(gotmpl.SprigFuncs()).Option("missingkey=default").Parse(value)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, parent.Object); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.ReplaceAll(buf.String(), "<no value>", "")), nil
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestLoadRelated(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	cl := fake.NewFakeClientWithScheme(scheme,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "strict", Namespace: "policies"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default", Labels: map[string]string{"site": "web"}}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default", Labels: map[string]string{"site": "web"}}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "default", Labels: map[string]string{"site": "other"}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}},
+	)
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Node"), meta.RESTScopeRoot)
+
+	parent := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "web", "namespace": "default"},
+		"spec":     map[string]interface{}{"policy": "strict", "node": "node-1"},
+	}}
+
+	cases := []struct {
+		name    string
+		related []apiv1.Related
+		keys    map[string][]string
+		errors  bool
+	}{
+		{name: "none"},
+		{
+			name:    "templatedName",
+			related: []apiv1.Related{{APIVersion: "v1", Kind: "ConfigMap", Namespace: "policies", Name: "{{ .spec.policy }}"}},
+			keys:    map[string][]string{"ConfigMap.v1": {"policies/strict"}},
+		},
+		{
+			name:    "missingValue",
+			related: []apiv1.Related{{APIVersion: "v1", Kind: "ConfigMap", Name: "{{ .spec.missing }}"}},
+			keys:    map[string][]string{"ConfigMap.v1": {}},
+		},
+		{
+			name:    "notFound",
+			related: []apiv1.Related{{APIVersion: "v1", Kind: "ConfigMap", Name: "missing"}},
+			keys:    map[string][]string{"ConfigMap.v1": {}},
+		},
+		{
+			name: "labelSelector",
+			related: []apiv1.Related{{APIVersion: "v1", Kind: "Secret", LabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"site": "{{ .metadata.name }}"},
+			}}},
+			keys: map[string][]string{"Secret.v1": {"a", "b"}},
+		},
+		{
+			name:    "clusterScoped",
+			related: []apiv1.Related{{APIVersion: "v1", Kind: "Node", Name: "{{ .spec.node }}"}},
+			keys:    map[string][]string{"Node.v1": {"node-1"}},
+		},
+		{name: "nameAndSelector", related: []apiv1.Related{{APIVersion: "v1", Kind: "Secret", Name: "a", LabelSelector: &metav1.LabelSelector{}}}, errors: true},
+		{name: "noNameOrSelector", related: []apiv1.Related{{APIVersion: "v1", Kind: "Secret"}}, errors: true},
+		{name: "templatedNamespace", related: []apiv1.Related{{APIVersion: "v1", Kind: "ConfigMap", Namespace: "{{ .spec.namespace }}", Name: "strict"}}, errors: true},
+		{name: "env", related: []apiv1.Related{{APIVersion: "v1", Kind: "Secret", Name: `{{ env "HOME" }}`}}, errors: true},
+		{name: "invalidTemplate", related: []apiv1.Related{{APIVersion: "v1", Kind: "Secret", Name: "{{ .spec"}}, errors: true},
+		{name: "unknownType", related: []apiv1.Related{{APIVersion: "example.com/v1", Kind: "Policy", Name: "a"}}, errors: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctrl := &apiv1.Controller{Spec: apiv1.ControllerSpec{Related: c.related}}
+			related, err := LoadRelated(context.Background(), cl, mapper, ctrl, parent)
+			if c.errors {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			keys := make(map[string][]string)
+			for typ, objs := range related {
+				keys[typ] = []string{}
+				for name := range objs {
+					keys[typ] = append(keys[typ], name)
+				}
+				sort.Strings(keys[typ])
+			}
+			if c.keys == nil {
+				require.Empty(t, keys)
+				return
+			}
+			require.Equal(t, c.keys, keys)
+		})
+	}
+}
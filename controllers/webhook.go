@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"fmt"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/codeformio/declare/template/webhook"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// newWebhook returns the templater for the webhook of a Controller. The
+// dependencies of the Controller are reported as the children of
+// metacontroller requests, they are listed with the children reader (if
+// any, see setupOwnerIndexes).
+func newWebhook(c *apiv1.Controller, children client.Reader) (*webhook.Templater, error) {
+	if len(c.Spec.Source) > 0 || c.Spec.Chart != nil {
+		return nil, fmt.Errorf("webhook can not be combined with a source or chart")
+	}
+
+	wh := c.Spec.Webhook
+	opts := webhook.Options{
+		URL:      wh.URL,
+		Format:   string(wh.Format),
+		Retries:  webhook.DefaultRetries,
+		CABundle: wh.CABundle,
+		Insecure: wh.Insecure,
+
+		ChildReader: children,
+		Controller: map[string]interface{}{
+			"apiVersion": apiv1.GroupVersion.String(),
+			"kind":       apiv1.ControllerKind,
+			"metadata": map[string]interface{}{
+				"name":      c.Name,
+				"namespace": c.Namespace,
+				"uid":       string(c.UID),
+			},
+		},
+	}
+	if wh.Timeout != nil {
+		opts.Timeout = wh.Timeout.Duration
+	}
+	if wh.Retries != nil {
+		opts.Retries = int(*wh.Retries)
+	}
+	for _, d := range c.Spec.Dependencies {
+		opts.Children = append(opts.Children, schema.FromAPIVersionAndKind(d.APIVersion, d.Kind))
+	}
+
+	return webhook.New(opts)
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"testing"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewWebhook(t *testing.T) {
+	cases := []struct {
+		name   string
+		spec   apiv1.ControllerSpec
+		errors bool
+	}{
+		{name: "declare", spec: apiv1.ControllerSpec{Webhook: &apiv1.Webhook{URL: "https://render.example.com"}}},
+		{name: "metacontroller", spec: apiv1.ControllerSpec{
+			Webhook:      &apiv1.Webhook{URL: "https://render.example.com/sync", Format: apiv1.WebhookFormatMetacontroller},
+			Dependencies: []apiv1.Dependency{{APIVersion: "apps/v1", Kind: "Deployment"}},
+		}},
+		{name: "withSource", spec: apiv1.ControllerSpec{
+			Webhook: &apiv1.Webhook{URL: "https://render.example.com"},
+			Source:  map[string]string{"main.js": ""},
+		}, errors: true},
+		{name: "http", spec: apiv1.ControllerSpec{Webhook: &apiv1.Webhook{URL: "http://render.default.svc"}}, errors: true},
+		{name: "insecure", spec: apiv1.ControllerSpec{Webhook: &apiv1.Webhook{URL: "http://render.default.svc", Insecure: true}}},
+		{name: "invalidCABundle", spec: apiv1.ControllerSpec{Webhook: &apiv1.Webhook{URL: "https://render.example.com", CABundle: []byte("x")}}, errors: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctrl := &apiv1.Controller{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+				Spec:       c.spec,
+			}
+			_, err := newWebhook(ctrl, nil)
+			if c.errors {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
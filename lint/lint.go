@@ -0,0 +1,292 @@
+// Package lint statically checks Controllers for common mistakes.
+package lint
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/codeformio/declare/render"
+	"github.com/codeformio/declare/template"
+	templatefactory "github.com/codeformio/declare/template/factory"
+	"github.com/codeformio/declare/template/kustomize"
+	"github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+	"github.com/robertkrimen/otto"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Severity of a Finding.
+type Severity string
+
+const (
+	// SeverityError is used for problems that will make reconciles fail.
+	SeverityError Severity = "error"
+	// SeverityWarning is used for problems that are likely mistakes.
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is a problem found in a Controller.
+type Finding struct {
+	Severity Severity
+	Message  string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s", f.Severity, f.Message)
+}
+
+func errorf(format string, args ...interface{}) Finding {
+	return Finding{Severity: SeverityError, Message: fmt.Sprintf(format, args...)}
+}
+
+func warningf(format string, args ...interface{}) Finding {
+	return Finding{Severity: SeverityWarning, Message: fmt.Sprintf(format, args...)}
+}
+
+// HasErrors returns true if any of the findings is an error.
+func HasErrors(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Lint checks the source of a Controller. Checks that depend on the output
+// of the template use the golden test cases in the Controller's directory
+// (see render.DiscoverTests) as representative renders.
+func Lint(ctx context.Context, scheme *runtime.Scheme, c *apiv1.Controller, dir string) ([]Finding, error) {
+	var findings []Finding
+	// The source of a Controller with a chart only maps values (and is
+	// optional). Controllers with a webhook have no source to check.
+	if (c.Spec.Chart == nil || len(c.Spec.Source) > 0) && c.Spec.Webhook == nil {
+		findings = lintSource(c.Spec.Source)
+	}
+	if HasErrors(findings) {
+		// Rendering would fail on the same errors.
+		return findings, nil
+	}
+
+	cases, err := render.DiscoverTests(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(cases) == 0 {
+		return append(findings, warningf("no test cases found in %s, skipping checks of rendered output", filepath.Join(dir, render.TestsDir))), nil
+	}
+
+	var renders []rendered
+	for _, tc := range cases {
+		r, err := renderCase(ctx, scheme, c, tc)
+		if err != nil {
+			findings = append(findings, errorf("test case %s: %v", tc.Name, err))
+			continue
+		}
+		renders = append(renders, r)
+	}
+
+	findings = append(findings, lintDependencies(c, renders)...)
+	findings = append(findings, lintConfig(c, renders)...)
+
+	return findings, nil
+}
+
+// rendered is the input and output of rendering a test case.
+type rendered struct {
+	name   string
+	input  *template.Input
+	output *template.Output
+}
+
+func renderCase(ctx context.Context, scheme *runtime.Scheme, c *apiv1.Controller, tc render.TestCase) (rendered, error) {
+	parent, err := tc.Parent()
+	if err != nil {
+		return rendered{}, err
+	}
+	fixtures, err := tc.Fixtures(scheme)
+	if err != nil {
+		return rendered{}, err
+	}
+
+	input, _, err := render.Input(ctx, fixtures, c, parent)
+	if err != nil {
+		return rendered{}, err
+	}
+	output, err := render.Render(ctx, fixtures, c, parent)
+	if err != nil {
+		return rendered{}, err
+	}
+
+	return rendered{name: tc.Name, input: input, output: output}, nil
+}
+
+// lintSource checks the language specific requirements of the source files.
+func lintSource(src map[string]string) []Finding {
+	if len(src) == 0 {
+		return []Finding{errorf("spec.source is empty")}
+	}
+
+	src, kfiles := kustomize.Split(src)
+	if kfiles != nil {
+		if _, err := kustomize.Load(kfiles); err != nil {
+			return []Finding{errorf("spec.source: %v", err)}
+		}
+	}
+
+	lang, err := templatefactory.Language(src)
+	if err != nil {
+		return []Finding{errorf("spec.source: %v", err)}
+	}
+
+	switch lang {
+	case templatefactory.LangJSONNet:
+		return lintJsonnet(src)
+	case templatefactory.LangJavascript:
+		return lintJavascript(src)
+	case templatefactory.LangCUE, templatefactory.LangStarlark, templatefactory.LangGoTemplate, templatefactory.LangWasm:
+		// Checked when the test cases are rendered.
+		return nil
+	default:
+		return []Finding{errorf("spec.source: no files with a supported extension found")}
+	}
+}
+
+// lintJsonnet checks that there is a single main file that evaluates to a
+// function taking a request.
+func lintJsonnet(src map[string]string) []Finding {
+	var mains []string
+	for filename := range src {
+		if filepath.Ext(filename) == ".jsonnet" {
+			mains = append(mains, filename)
+		}
+	}
+	sort.Strings(mains)
+
+	switch len(mains) {
+	case 0:
+		return []Finding{errorf("spec.source: no .jsonnet file found (.libsonnet files are only imported)")}
+	case 1:
+	default:
+		return []Finding{errorf("spec.source: multiple .jsonnet files found (%s), only one is evaluated", strings.Join(mains, ", "))}
+	}
+
+	filename := mains[0]
+	node, err := jsonnet.SnippetToAST(filename, src[filename])
+	if err != nil {
+		return []Finding{errorf("%s: %v", filename, err)}
+	}
+
+	// Skip top-level locals, i.e. "local x = 1; function(request) ...".
+	for {
+		local, ok := node.(*ast.Local)
+		if !ok {
+			break
+		}
+		node = local.Body
+	}
+
+	fn, ok := node.(*ast.Function)
+	if !ok {
+		return []Finding{errorf("%s: does not evaluate to a function, expected: function(request) { ... }", filename)}
+	}
+	for _, p := range fn.Parameters {
+		if p.Name == "request" {
+			return nil
+		}
+	}
+	return []Finding{errorf("%s: top-level function does not take a 'request' parameter", filename)}
+}
+
+// lintJavascript checks that the source defines a sync function.
+func lintJavascript(src map[string]string) []Finding {
+	var filenames []string
+	for filename := range src {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	vm := otto.New()
+	for _, filename := range filenames {
+		if _, err := vm.Run(src[filename]); err != nil {
+			return []Finding{errorf("%s: %v", filename, err)}
+		}
+	}
+
+	sync, err := vm.Get("sync")
+	if err != nil {
+		return []Finding{errorf("getting sync function: %v", err)}
+	}
+	if !sync.IsFunction() {
+		return []Finding{errorf("spec.source: no sync function defined, expected: function sync(request) { ... }")}
+	}
+	return nil
+}
+
+// lintDependencies checks that all emitted children are declared as
+// dependencies and that watched dependencies are emitted.
+func lintDependencies(c *apiv1.Controller, renders []rendered) []Finding {
+	var findings []Finding
+
+	declared := make(map[schema.GroupVersionKind]bool, len(c.Spec.Dependencies))
+	for _, d := range c.Spec.Dependencies {
+		declared[schema.FromAPIVersionAndKind(d.APIVersion, d.Kind)] = true
+	}
+
+	emitted := make(map[schema.GroupVersionKind]bool)
+	for _, r := range renders {
+		reported := make(map[schema.GroupVersionKind]bool)
+		for _, obj := range r.output.Apply {
+			gvk := obj.GroupVersionKind()
+			emitted[gvk] = true
+			if !declared[gvk] && !reported[gvk] {
+				reported[gvk] = true
+				findings = append(findings, errorf("test case %s: %s %s is emitted but not declared in spec.dependencies", r.name, gvk.GroupVersion(), gvk.Kind))
+			}
+		}
+	}
+
+	for _, d := range c.Spec.Dependencies {
+		if d.Watch && !emitted[schema.FromAPIVersionAndKind(d.APIVersion, d.Kind)] {
+			findings = append(findings, warningf("dependency %s %s is watched but not emitted by any test case", d.APIVersion, d.Kind))
+		}
+	}
+
+	return findings
+}
+
+// lintConfig checks that all config keys are referenced in the source.
+// This is a textual check: a key is considered used if it appears anywhere
+// in the source.
+func lintConfig(c *apiv1.Controller, renders []rendered) []Finding {
+	var src strings.Builder
+	for _, s := range c.Spec.Source {
+		src.WriteString(s)
+	}
+
+	keys := make(map[string]bool)
+	for _, r := range renders {
+		for k := range r.input.Config {
+			keys[k] = true
+		}
+	}
+
+	var unused []string
+	for k := range keys {
+		if !strings.Contains(src.String(), k) {
+			unused = append(unused, k)
+		}
+	}
+	sort.Strings(unused)
+
+	var findings []Finding
+	for _, k := range unused {
+		findings = append(findings, warningf("config key %q is not referenced in the source", k))
+	}
+	return findings
+}
@@ -0,0 +1,109 @@
+package lint
+
+import (
+	"testing"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/codeformio/declare/template"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestLintSource(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    map[string]string
+		errors bool
+	}{
+		{
+			name: "jsonnet",
+			src:  map[string]string{"main.jsonnet": `local x = 1; function(request) { apply: [] }`},
+		},
+		{
+			name:   "jsonnetNotFunction",
+			src:    map[string]string{"main.jsonnet": `{ apply: [] }`},
+			errors: true,
+		},
+		{
+			name:   "jsonnetWrongParameter",
+			src:    map[string]string{"main.jsonnet": `function(req) { apply: [] }`},
+			errors: true,
+		},
+		{
+			name:   "jsonnetOnlyLibrary",
+			src:    map[string]string{"lib.libsonnet": `{}`},
+			errors: true,
+		},
+		{
+			name:   "jsonnetMultipleMains",
+			src:    map[string]string{"a.jsonnet": `function(request) {}`, "b.jsonnet": `function(request) {}`},
+			errors: true,
+		},
+		{
+			name:   "jsonnetSyntaxError",
+			src:    map[string]string{"main.jsonnet": `function(request) {`},
+			errors: true,
+		},
+		{
+			name: "javascript",
+			src:  map[string]string{"main.js": `function sync(request) { return {apply: []}; }`},
+		},
+		{
+			name:   "javascriptMissingSync",
+			src:    map[string]string{"main.js": `function render(request) { return {apply: []}; }`},
+			errors: true,
+		},
+		{
+			name:   "mixedLanguages",
+			src:    map[string]string{"main.js": `function sync(request) {}`, "main.jsonnet": `function(request) {}`},
+			errors: true,
+		},
+		{
+			name:   "empty",
+			errors: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			findings := lintSource(c.src)
+			require.Equal(t, c.errors, HasErrors(findings), "findings: %v", findings)
+		})
+	}
+}
+
+func TestLintRendered(t *testing.T) {
+	c := &apiv1.Controller{
+		Spec: apiv1.ControllerSpec{
+			Dependencies: []apiv1.Dependency{
+				{APIVersion: "v1", Kind: "Service"},
+				{APIVersion: "apps/v1", Kind: "Deployment", Watch: true},
+			},
+			Source: map[string]string{"main.jsonnet": `function(request) { replicas: request.config.replicas }`},
+		},
+	}
+
+	child := func(apiVersion, kind string) *unstructured.Unstructured {
+		var obj unstructured.Unstructured
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		return &obj
+	}
+
+	renders := []rendered{
+		{
+			name:   "basic",
+			input:  &template.Input{Config: map[string]interface{}{"replicas": "3", "region": "us-east1"}},
+			output: &template.Output{Apply: []*unstructured.Unstructured{child("v1", "Service"), child("v1", "ConfigMap"), child("v1", "ConfigMap")}},
+		},
+	}
+
+	require.Equal(t, []Finding{
+		{Severity: SeverityError, Message: "test case basic: v1 ConfigMap is emitted but not declared in spec.dependencies"},
+		{Severity: SeverityWarning, Message: "dependency apps/v1 Deployment is watched but not emitted by any test case"},
+	}, lintDependencies(c, renders))
+
+	require.Equal(t, []Finding{
+		{Severity: SeverityWarning, Message: `config key "region" is not referenced in the source`},
+	}, lintConfig(c, renders))
+}
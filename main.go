@@ -21,7 +21,6 @@ import (
 	"flag"
 	"os"
 
-	"go.uber.org/zap/zapcore"
 	apiext "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -33,6 +32,7 @@ import (
 	configv1 "github.com/codeformio/declare/api/v1"
 
 	"github.com/codeformio/declare/controllers"
+	"github.com/codeformio/declare/tracing"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -52,14 +52,34 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var tracingOpts tracing.Options
+	var opts controllers.Options
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&tracingOpts.Endpoint, "otlp-endpoint", "",
+		"The host:port of an OTLP/HTTP collector to export traces to. Tracing is disabled when empty.")
+	flag.BoolVar(&tracingOpts.Insecure, "otlp-insecure", false, "Disable TLS when exporting traces.")
+	flag.BoolVar(&opts.RequireServiceAccount, "require-service-account", false,
+		"Require Controllers to specify a ServiceAccount to impersonate instead of using the permissions of the manager.")
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
 
+	if tracingOpts.Endpoint != "" {
+		shutdown, err := tracing.Setup(context.Background(), tracingOpts)
+		if err != nil {
+			setupLog.Error(err, "setting up tracing")
+			os.Exit(1)
+		}
+		defer func() {
+			if err := shutdown(context.Background()); err != nil {
+				setupLog.Error(err, "shutting down tracing")
+			}
+		}()
+	}
+
 	restConfig := ctrl.GetConfigOrDie()
 	client, err := client.New(restConfig, client.Options{Scheme: scheme})
 	if err != nil {
@@ -71,7 +91,7 @@ func main() {
 		Scheme:             scheme,
 		MetricsBindAddress: metricsAddr,
 		Port:               9443,
-		Logger:             zap.New(zap.Level(zapcore.DebugLevel), zap.UseDevMode(true)),
+		Logger:             zap.New(zap.UseDevMode(true)),
 		LeaderElection:     enableLeaderElection,
 		LeaderElectionID:   "d26717b8.declare.dev",
 	})
@@ -89,7 +109,7 @@ func main() {
 		close(stop)
 	}()
 
-	if err := controllers.Register(context.Background(), client, mgr, stop); err != nil {
+	if err := controllers.Register(context.Background(), client, mgr, stop, opts); err != nil {
 		setupLog.Error(err, "registering controllers")
 		os.Exit(1)
 	}
@@ -0,0 +1,212 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/codeformio/declare/controllers"
+	"github.com/pmezard/go-difflib/difflib"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// ChildStatus describes how a child would change.
+type ChildStatus string
+
+const (
+	ChildCreated   ChildStatus = "created"
+	ChildChanged   ChildStatus = "changed"
+	ChildUnchanged ChildStatus = "unchanged"
+	ChildInvalid   ChildStatus = "invalid"
+)
+
+// InstanceDiff is the difference between the rendered children of a parent
+// and the children in the cluster.
+type InstanceDiff struct {
+	Parent types.NamespacedName
+	// Error is set when rendering the parent failed.
+	Error    error
+	Children []ChildDiff
+}
+
+// ChildDiff is the difference between a rendered child and the child in the
+// cluster.
+type ChildDiff struct {
+	GroupVersionKind schema.GroupVersionKind
+	Key              types.NamespacedName
+	Status           ChildStatus
+	// Diff is a unified diff of the fields set by the template, it is only
+	// set for changed children. The reason is set for invalid children.
+	Diff string
+}
+
+// Diff renders a Controller for every existing instance of its parent type
+// and compares the children to the objects in the cluster. Only the fields
+// that are set by the template are compared (the same fields that would be
+// applied). The mapper tells namespaced from cluster scoped children. The
+// cluster is only read from.
+func Diff(ctx context.Context, r client.Reader, mapper meta.RESTMapper, c *apiv1.Controller, opts ...client.ListOption) ([]InstanceDiff, error) {
+	c = c.DeepCopy()
+	if c.Namespace == "" {
+		c.Namespace = DefaultNamespace
+	}
+
+	var parents unstructured.UnstructuredList
+	parents.SetAPIVersion(c.Spec.For.APIVersion)
+	parents.SetKind(c.Spec.For.Kind + "List")
+	if err := r.List(ctx, &parents, opts...); err != nil {
+		return nil, fmt.Errorf("listing %s: %w", c.Spec.For.Kind, err)
+	}
+
+	declared := make(map[schema.GroupVersionKind]bool, len(c.Spec.Dependencies))
+	for _, d := range c.Spec.Dependencies {
+		declared[schema.FromAPIVersionAndKind(d.APIVersion, d.Kind)] = true
+	}
+
+	var diffs []InstanceDiff
+	for i := range parents.Items {
+		parent := &parents.Items[i]
+		d := InstanceDiff{Parent: types.NamespacedName{Namespace: parent.GetNamespace(), Name: parent.GetName()}}
+
+		out, secrets, err := render(ctx, r, c, parent)
+		if err != nil {
+			d.Error = err
+			diffs = append(diffs, d)
+			continue
+		}
+
+		for _, obj := range out.Apply {
+			gvk := obj.GroupVersionKind()
+			child := ChildDiff{
+				GroupVersionKind: gvk,
+				Key:              types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()},
+			}
+
+			mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+			if err != nil {
+				child.Status = ChildInvalid
+				child.Diff = fmt.Sprintf("getting REST mapping: %v", err)
+				d.Children = append(d.Children, child)
+				continue
+			}
+			defaulted := true
+			if obj.GetNamespace() == "" && mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+				obj.SetNamespace(controllers.DefaultChildNamespace(c, parent))
+				child.Key.Namespace = obj.GetNamespace()
+				defaulted = obj.GetNamespace() != ""
+			}
+
+			if !defaulted {
+				child.Status = ChildInvalid
+				child.Diff = "namespace must be specified, it is not defaulted by Controller (.spec.namespacePolicy)"
+				d.Children = append(d.Children, child)
+				continue
+			}
+
+			if !declared[gvk] {
+				child.Status = ChildInvalid
+				child.Diff = "dependency is not declared in Controller (.spec.dependencies)"
+				d.Children = append(d.Children, child)
+				continue
+			}
+
+			if err := secrets.Resolve(obj.Object); err != nil {
+				child.Status = ChildInvalid
+				child.Diff = err.Error()
+				d.Children = append(d.Children, child)
+				continue
+			}
+			if err := diffChild(ctx, r, obj, &child); err != nil {
+				return nil, err
+			}
+			child.Diff = secrets.Redact(child.Diff)
+			d.Children = append(d.Children, child)
+		}
+
+		diffs = append(diffs, d)
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Parent.String() < diffs[j].Parent.String()
+	})
+
+	return diffs, nil
+}
+
+func diffChild(ctx context.Context, r client.Reader, obj *unstructured.Unstructured, child *ChildDiff) error {
+	var live unstructured.Unstructured
+	live.SetGroupVersionKind(obj.GroupVersionKind())
+	if err := r.Get(ctx, child.Key, &live); err != nil {
+		if apierrors.IsNotFound(err) {
+			child.Status = ChildCreated
+			return nil
+		}
+		return fmt.Errorf("getting %s %s: %w", obj.GetKind(), child.Key, err)
+	}
+
+	before, err := yaml.Marshal(project(live.Object, obj.Object))
+	if err != nil {
+		return err
+	}
+	after, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+
+	if string(before) == string(after) {
+		child.Status = ChildUnchanged
+		return nil
+	}
+
+	child.Status = ChildChanged
+	child.Diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(before)),
+		B:        difflib.SplitLines(string(after)),
+		FromFile: "live",
+		ToFile:   "rendered",
+		Context:  3,
+	})
+	return err
+}
+
+// project returns the fields of live that are set in desired. Lists are
+// projected element by element, additional elements in live are kept.
+func project(live, desired interface{}) interface{} {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return live
+		}
+		out := make(map[string]interface{}, len(d))
+		for k, v := range d {
+			if lv, ok := l[k]; ok {
+				out[k] = project(lv, v)
+			}
+		}
+		return out
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			return live
+		}
+		out := make([]interface{}, len(l))
+		for i, lv := range l {
+			if i < len(d) {
+				out[i] = project(lv, d[i])
+			} else {
+				out[i] = lv
+			}
+		}
+		return out
+	default:
+		return live
+	}
+}
@@ -0,0 +1,139 @@
+package render_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/codeformio/declare/render"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+const liveManifests = `
+apiVersion: example.com/v1
+kind: App
+metadata:
+  name: web
+  namespace: team-a
+spec:
+  port: 8080
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: creds
+  namespace: default
+data:
+  token: c3VwZXItc2VjcmV0
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: default
+  resourceVersion: "123"
+spec:
+  clusterIP: 10.0.0.1
+  ports:
+  - port: 80
+    protocol: TCP
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-settings
+  namespace: default
+data:
+  token: old-token
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: web
+  namespace: default
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: web
+rules: []
+`
+
+func TestDiff(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+
+	objs, err := render.DecodeManifests(strings.NewReader(liveManifests))
+	require.NoError(t, err)
+	live := render.NewFixtures(scheme)
+	live.Add(objs...)
+
+	c := &apiv1.Controller{
+		Spec: apiv1.ControllerSpec{
+			For: apiv1.ResourceType{APIVersion: "example.com/v1", Kind: "App"},
+			Dependencies: []apiv1.Dependency{
+				{APIVersion: "v1", Kind: "Service"},
+				{APIVersion: "v1", Kind: "ServiceAccount"},
+				{APIVersion: "v1", Kind: "ConfigMap"},
+				{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole"},
+			},
+			Config: []apiv1.ConfigSource{{Secret: "creds", Reference: true}},
+			Source: map[string]string{
+				"main.jsonnet": `
+function(request) {
+  local name = request.object.metadata.name,
+  apply: [
+    { apiVersion: 'v1', kind: 'Service', metadata: { name: name }, spec: { ports: [{ port: request.object.spec.port, protocol: 'TCP' }] } },
+    { apiVersion: 'v1', kind: 'ServiceAccount', metadata: { name: name } },
+    { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: name + '-settings' }, data: { token: request.config.token } },
+    { apiVersion: 'v1', kind: 'ConfigMap', metadata: { name: name + '-new' } },
+    { apiVersion: 'v1', kind: 'Secret', metadata: { name: name } },
+    { apiVersion: 'rbac.authorization.k8s.io/v1', kind: 'ClusterRole', metadata: { name: name }, rules: [] },
+  ],
+}
+`,
+			},
+		},
+	}
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for _, kind := range []string{"Service", "ServiceAccount", "ConfigMap", "Secret"} {
+		mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: kind}, meta.RESTScopeNamespace)
+	}
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+
+	diffs, err := render.Diff(context.Background(), live, mapper, c)
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	require.NoError(t, diffs[0].Error)
+	require.Equal(t, types.NamespacedName{Namespace: "team-a", Name: "web"}, diffs[0].Parent)
+
+	children := diffs[0].Children
+	require.Len(t, children, 6)
+
+	require.Equal(t, render.ChildChanged, children[0].Status)
+	require.Equal(t, types.NamespacedName{Namespace: "default", Name: "web"}, children[0].Key)
+	require.Contains(t, children[0].Diff, "-  - port: 80")
+	require.Contains(t, children[0].Diff, "+  - port: 8080")
+	require.NotContains(t, children[0].Diff, "clusterIP", "fields that are not set by the template are ignored")
+
+	require.Equal(t, render.ChildUnchanged, children[1].Status)
+
+	// Secret references are resolved before comparing but redacted in the diff.
+	require.Equal(t, render.ChildChanged, children[2].Status)
+	require.Contains(t, children[2].Diff, "+  token: [REDACTED]")
+	require.NotContains(t, children[2].Diff, "super-secret")
+
+	require.Equal(t, render.ChildCreated, children[3].Status)
+	require.Equal(t, render.ChildInvalid, children[4].Status)
+
+	// Cluster scoped children are not namespaced.
+	require.Equal(t, render.ChildUnchanged, children[5].Status)
+	require.Equal(t, types.NamespacedName{Name: "web"}, children[5].Key)
+}
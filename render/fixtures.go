@@ -0,0 +1,211 @@
+package render
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Fixtures is a client.Reader that serves objects from manifests instead of
+// the k8s API server. Objects without a namespace match any namespace.
+type Fixtures struct {
+	scheme  *runtime.Scheme
+	objects []*unstructured.Unstructured
+}
+
+var _ client.Reader = &Fixtures{}
+
+// NewFixtures returns an empty set of fixtures. The scheme is used to
+// convert between typed and unstructured objects.
+func NewFixtures(scheme *runtime.Scheme) *Fixtures {
+	return &Fixtures{scheme: scheme}
+}
+
+// Add adds objects to the fixtures.
+func (f *Fixtures) Add(objs ...*unstructured.Unstructured) {
+	f.objects = append(f.objects, objs...)
+}
+
+// AddPath adds all manifests in a file or (recursively) in a directory.
+// Only files with a .yaml, .yml or .json extension are read from directories.
+func (f *Fixtures) AddPath(path string) error {
+	return filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if p != path {
+			switch filepath.Ext(p) {
+			case ".yaml", ".yml", ".json":
+			default:
+				return nil
+			}
+		}
+
+		objs, err := ReadManifests(p)
+		if err != nil {
+			return err
+		}
+		f.Add(objs...)
+		return nil
+	})
+}
+
+// ReadManifests reads all objects in a (multi-document) YAML or JSON file.
+func ReadManifests(path string) ([]*unstructured.Unstructured, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	objs, err := DecodeManifests(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return objs, nil
+}
+
+// DecodeManifests decodes all objects in a (multi-document) YAML or JSON
+// stream. Lists (i.e. v1/List) are flattened.
+func DecodeManifests(r io.Reader) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+
+	dec := utilyaml.NewYAMLOrJSONDecoder(bufio.NewReader(r), 4096)
+	for {
+		var obj unstructured.Unstructured
+		if err := dec.Decode(&obj.Object); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+
+		if obj.IsList() {
+			if err := obj.EachListItem(func(item runtime.Object) error {
+				objs = append(objs, item.(*unstructured.Unstructured))
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if obj.GetKind() == "" || obj.GetAPIVersion() == "" {
+			return nil, fmt.Errorf("object %q is missing apiVersion or kind", obj.GetName())
+		}
+		objs = append(objs, &obj)
+	}
+
+	return objs, nil
+}
+
+// Get implements client.Reader.
+func (f *Fixtures) Get(_ context.Context, key client.ObjectKey, obj runtime.Object) error {
+	gvk, err := f.gvkFor(obj)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range f.objects {
+		if o.GroupVersionKind() != gvk || o.GetName() != key.Name || !namespaceMatches(o, key.Namespace) {
+			continue
+		}
+		return f.into(o, obj)
+	}
+
+	return apierrors.NewNotFound(schema.GroupResource{
+		Group:    gvk.Group,
+		Resource: strings.ToLower(gvk.Kind),
+	}, key.Name)
+}
+
+// List implements client.Reader. Only the namespace and label selector
+// options are supported.
+func (f *Fixtures) List(_ context.Context, list runtime.Object, opts ...client.ListOption) error {
+	gvk, err := f.gvkFor(list)
+	if err != nil {
+		return err
+	}
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+
+	var lo client.ListOptions
+	lo.ApplyOptions(opts)
+	if lo.FieldSelector != nil && !lo.FieldSelector.Empty() {
+		return fmt.Errorf("field selectors are not supported by fixtures")
+	}
+
+	var items []runtime.Object
+	for _, o := range f.objects {
+		if o.GroupVersionKind() != gvk || !namespaceMatches(o, lo.Namespace) {
+			continue
+		}
+		if lo.LabelSelector != nil && !lo.LabelSelector.Matches(labels.Set(o.GetLabels())) {
+			continue
+		}
+
+		var item runtime.Object = &unstructured.Unstructured{}
+		if _, ok := list.(*unstructured.UnstructuredList); !ok {
+			if item, err = f.scheme.New(gvk); err != nil {
+				return err
+			}
+		}
+		if err := f.into(o, item); err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+
+	if ul, ok := list.(*unstructured.UnstructuredList); ok {
+		ul.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+	}
+	return meta.SetList(list, items)
+}
+
+func (f *Fixtures) gvkFor(obj runtime.Object) (schema.GroupVersionKind, error) {
+	if u, ok := obj.(runtime.Unstructured); ok {
+		gvk := u.GetObjectKind().GroupVersionKind()
+		if gvk.Empty() {
+			return gvk, fmt.Errorf("unstructured object is missing apiVersion or kind")
+		}
+		return gvk, nil
+	}
+
+	gvks, _, err := f.scheme.ObjectKinds(obj)
+	if err != nil {
+		return schema.GroupVersionKind{}, err
+	}
+	return gvks[0], nil
+}
+
+// into copies a fixture into obj (which can be typed or unstructured).
+func (f *Fixtures) into(src *unstructured.Unstructured, obj runtime.Object) error {
+	cp := src.DeepCopy()
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		u.Object = cp.Object
+		return nil
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(cp.Object, obj)
+}
+
+func namespaceMatches(obj *unstructured.Unstructured, namespace string) bool {
+	return namespace == "" || obj.GetNamespace() == "" || obj.GetNamespace() == namespace
+}
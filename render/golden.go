@@ -0,0 +1,166 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/codeformio/declare/template"
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// Golden test cases live in a directory next to the Controller manifest:
+//
+//	controller.yaml
+//	tests/<case>/parent.yaml      the parent object (required)
+//	tests/<case>/config.yaml      config Secrets and ConfigMaps (optional)
+//	tests/<case>/fixtures/        objects read by the template (optional)
+//	tests/<case>/expected.yaml    the expected output of the template
+const (
+	ControllerFile   = "controller.yaml"
+	TestsDir         = "tests"
+	testParentFile   = "parent.yaml"
+	testConfigFile   = "config.yaml"
+	testFixturesDir  = "fixtures"
+	testExpectedFile = "expected.yaml"
+)
+
+// TestCase is a golden test case of a Controller.
+type TestCase struct {
+	Name string
+	Dir  string
+}
+
+// Parent reads the parent object of the test case.
+func (tc TestCase) Parent() (*unstructured.Unstructured, error) {
+	return ReadObject(filepath.Join(tc.Dir, testParentFile))
+}
+
+// Fixtures reads the config and fixture objects of the test case.
+func (tc TestCase) Fixtures(scheme *runtime.Scheme) (*Fixtures, error) {
+	fixtures := NewFixtures(scheme)
+	for _, p := range []string{testConfigFile, testFixturesDir} {
+		p = filepath.Join(tc.Dir, p)
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			continue
+		}
+		if err := fixtures.AddPath(p); err != nil {
+			return nil, err
+		}
+	}
+	return fixtures, nil
+}
+
+// TestResult is the result of running a TestCase.
+type TestResult struct {
+	TestCase
+	// Diff is a unified diff between the expected and the actual output.
+	// It is empty when the test passed.
+	Diff string
+	// Updated is true when the expected output was (re)written.
+	Updated bool
+}
+
+// Passed returns true if the actual output matched the expected output.
+func (r *TestResult) Passed() bool {
+	return r.Diff == ""
+}
+
+// DiscoverTests returns the test cases of the Controller in a directory,
+// sorted by name.
+func DiscoverTests(controllerDir string) ([]TestCase, error) {
+	testsDir := filepath.Join(controllerDir, TestsDir)
+	entries, err := ioutil.ReadDir(testsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var cases []TestCase
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(testsDir, e.Name())
+		if _, err := os.Stat(filepath.Join(dir, testParentFile)); err != nil {
+			return nil, fmt.Errorf("test case %s: %w", dir, err)
+		}
+		cases = append(cases, TestCase{Name: e.Name(), Dir: dir})
+	}
+	sort.Slice(cases, func(i, j int) bool { return cases[i].Name < cases[j].Name })
+
+	return cases, nil
+}
+
+// RunTest renders a test case and compares the output to the expected
+// output. With update, the expected output is rewritten instead.
+func RunTest(ctx context.Context, scheme *runtime.Scheme, c *apiv1.Controller, tc TestCase, update bool) (*TestResult, error) {
+	parent, err := tc.Parent()
+	if err != nil {
+		return nil, err
+	}
+	fixtures, err := tc.Fixtures(scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := Render(ctx, fixtures, c, parent)
+	if err != nil {
+		return nil, err
+	}
+	actual, err := MarshalOutput(out)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &TestResult{TestCase: tc}
+	expectedPath := filepath.Join(tc.Dir, testExpectedFile)
+
+	if update {
+		if err := ioutil.WriteFile(expectedPath, actual, 0644); err != nil {
+			return nil, err
+		}
+		res.Updated = true
+		return res, nil
+	}
+
+	expected, err := ioutil.ReadFile(expectedPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if bytes.Equal(expected, actual) {
+		return res, nil
+	}
+
+	res.Diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(expected)),
+		B:        difflib.SplitLines(string(actual)),
+		FromFile: expectedPath,
+		ToFile:   "actual",
+		Context:  3,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// MarshalOutput marshals the output of a template as YAML.
+func MarshalOutput(out *template.Output) ([]byte, error) {
+	y, err := yaml.Marshal(out)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling output: %w", err)
+	}
+	return y, nil
+}
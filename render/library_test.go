@@ -0,0 +1,45 @@
+package render_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/codeformio/declare/render"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+// TestLibrary runs the golden test cases of the library Controllers.
+// Run `declare test --update library/<name>` to update the expected output.
+func TestLibrary(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, apiv1.AddToScheme(scheme))
+
+	paths, err := filepath.Glob(filepath.Join("..", "library", "*", render.ControllerFile))
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+
+	for _, p := range paths {
+		dir := filepath.Dir(p)
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			c, err := render.ReadController(p)
+			require.NoError(t, err)
+
+			cases, err := render.DiscoverTests(dir)
+			require.NoError(t, err)
+			require.NotEmpty(t, cases, "library controllers should have test cases")
+
+			for _, tc := range cases {
+				t.Run(tc.Name, func(t *testing.T) {
+					res, err := render.RunTest(context.Background(), scheme, c, tc, false)
+					require.NoError(t, err)
+					require.True(t, res.Passed(), "output does not match %s:\n%s", tc.Dir, res.Diff)
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Package render renders Controllers offline, without a k8s cluster.
+package render
+
+import (
+	"context"
+	"fmt"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/codeformio/declare/controllers"
+	"github.com/codeformio/declare/template"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultNamespace is used for Controllers and parents that do not specify
+// a namespace (the same namespace kubectl would default to).
+const DefaultNamespace = "default"
+
+// Render runs the template of a Controller for a parent object. Config and
+// objects read by the template are resolved through the reader.
+func Render(ctx context.Context, r client.Reader, c *apiv1.Controller, parent *unstructured.Unstructured) (*template.Output, error) {
+	out, _, err := render(ctx, r, c, parent)
+	return out, err
+}
+
+func render(ctx context.Context, r client.Reader, c *apiv1.Controller, parent *unstructured.Unstructured) (*template.Output, *controllers.Secrets, error) {
+	input, secrets, err := Input(ctx, r, c, parent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c = c.DeepCopy()
+	if c.Namespace == "" {
+		c.Namespace = DefaultNamespace
+	}
+	t, _, err := controllers.NewTemplater(ctx, r, c)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating templater: %w", err)
+	}
+	defer template.Close(ctx, t)
+
+	out, err := t.Template(ctx, r, input)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, secrets, nil
+}
+
+// Input builds the template input of a Controller for a parent object.
+// All dependencies of the Controller are considered to be supported. The
+// returned Secrets resolve the secret references in the config.
+func Input(ctx context.Context, r client.Reader, c *apiv1.Controller, parent *unstructured.Unstructured) (*template.Input, *controllers.Secrets, error) {
+	c = c.DeepCopy()
+	if c.Namespace == "" {
+		c.Namespace = DefaultNamespace
+	}
+	parent = parent.DeepCopy()
+	if parent.GetNamespace() == "" {
+		parent.SetNamespace(DefaultNamespace)
+	}
+
+	forGVK := schema.FromAPIVersionAndKind(c.Spec.For.APIVersion, c.Spec.For.Kind)
+	if parent.GroupVersionKind() != forGVK {
+		return nil, nil, fmt.Errorf("parent is a %v, controller is for %v", parent.GroupVersionKind(), forGVK)
+	}
+
+	cfg, secrets, err := controllers.LoadConfig(ctx, r, c, parent)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading config: %w", err)
+	}
+
+	supported := make(map[string]bool, len(c.Spec.Dependencies))
+	for _, d := range c.Spec.Dependencies {
+		supported[template.SupportedKey(schema.FromAPIVersionAndKind(d.APIVersion, d.Kind))] = true
+	}
+
+	related, err := controllers.LoadRelated(ctx, r, nil, c, parent)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading related objects: %w", err)
+	}
+
+	return &template.Input{Object: parent, Config: cfg, Supported: supported, Related: related}, secrets, nil
+}
+
+// ReadController reads a Controller from a manifest file. The file must
+// contain exactly one Controller (other objects, i.e. CRDs, are ignored).
+func ReadController(path string) (*apiv1.Controller, error) {
+	objs, err := ReadManifests(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []*unstructured.Unstructured
+	for _, obj := range objs {
+		if obj.GroupVersionKind() == apiv1.GroupVersion.WithKind("Controller") {
+			found = append(found, obj)
+		}
+	}
+	if len(found) != 1 {
+		return nil, fmt.Errorf("expected 1 Controller in %s, found %d", path, len(found))
+	}
+
+	var c apiv1.Controller
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(found[0].Object, &c); err != nil {
+		return nil, fmt.Errorf("converting controller: %w", err)
+	}
+	return &c, nil
+}
+
+// ReadObject reads a single object from a manifest file.
+func ReadObject(path string) (*unstructured.Unstructured, error) {
+	objs, err := ReadManifests(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(objs) != 1 {
+		return nil, fmt.Errorf("expected 1 object in %s, found %d", path, len(objs))
+	}
+	return objs[0], nil
+}
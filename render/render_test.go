@@ -0,0 +1,211 @@
+package render_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/codeformio/declare/render"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const fixtureManifests = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: team-a
+  labels:
+    app: web
+data:
+  replicas: "3"
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: shared
+data:
+  region: us-east1
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: creds
+    namespace: team-a
+  data:
+    password: aHVudGVyMg==
+`
+
+func newFixtures(t *testing.T) *render.Fixtures {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+
+	objs, err := render.DecodeManifests(strings.NewReader(fixtureManifests))
+	require.NoError(t, err)
+	require.Len(t, objs, 3)
+
+	f := render.NewFixtures(scheme)
+	f.Add(objs...)
+	return f
+}
+
+func TestFixturesGet(t *testing.T) {
+	f := newFixtures(t)
+	ctx := context.Background()
+
+	var cm corev1.ConfigMap
+	require.NoError(t, f.Get(ctx, types.NamespacedName{Namespace: "team-a", Name: "settings"}, &cm))
+	require.Equal(t, "3", cm.Data["replicas"])
+
+	// Objects without a namespace match any namespace.
+	require.NoError(t, f.Get(ctx, types.NamespacedName{Namespace: "team-b", Name: "shared"}, &cm))
+	require.Equal(t, "us-east1", cm.Data["region"])
+
+	var s corev1.Secret
+	require.NoError(t, f.Get(ctx, types.NamespacedName{Namespace: "team-a", Name: "creds"}, &s))
+	require.Equal(t, "hunter2", string(s.Data["password"]))
+
+	var u unstructured.Unstructured
+	u.SetAPIVersion("v1")
+	u.SetKind("ConfigMap")
+	require.NoError(t, f.Get(ctx, types.NamespacedName{Namespace: "team-a", Name: "settings"}, &u))
+	require.Equal(t, "settings", u.GetName())
+
+	err := f.Get(ctx, types.NamespacedName{Namespace: "team-b", Name: "settings"}, &cm)
+	require.True(t, apierrors.IsNotFound(err), "expected not found, got: %v", err)
+}
+
+func TestFixturesList(t *testing.T) {
+	f := newFixtures(t)
+	ctx := context.Background()
+
+	var all corev1.ConfigMapList
+	require.NoError(t, f.List(ctx, &all))
+	require.Len(t, all.Items, 2)
+
+	var selected corev1.ConfigMapList
+	require.NoError(t, f.List(ctx, &selected, client.InNamespace("team-a"), client.MatchingLabelsSelector{Selector: labels.SelectorFromSet(labels.Set{"app": "web"})}))
+	require.Len(t, selected.Items, 1)
+	require.Equal(t, "settings", selected.Items[0].Name)
+
+	var ul unstructured.UnstructuredList
+	ul.SetAPIVersion("v1")
+	ul.SetKind("SecretList")
+	require.NoError(t, f.List(ctx, &ul, client.InNamespace("team-b")))
+	require.Len(t, ul.Items, 0)
+}
+
+func TestRender(t *testing.T) {
+	f := newFixtures(t)
+
+	c := &apiv1.Controller{
+		Spec: apiv1.ControllerSpec{
+			For: apiv1.ResourceType{APIVersion: "example.com/v1", Kind: "App"},
+			Dependencies: []apiv1.Dependency{
+				{APIVersion: "v1", Kind: "ConfigMap"},
+			},
+			Config: []apiv1.ConfigSource{{ConfigMap: "shared"}},
+			Source: map[string]string{
+				"main.jsonnet": `
+function(request) {
+  local settings = std.native('getObject')({
+    apiVersion: 'v1',
+    kind: 'ConfigMap',
+    metadata: { name: 'settings', namespace: request.object.metadata.namespace },
+  }),
+  apply: [
+    {
+      apiVersion: 'v1',
+      kind: 'ConfigMap',
+      metadata: { name: request.object.metadata.name },
+      data: {
+        region: request.config.region,
+        replicas: settings.data.replicas,
+        supported: std.toString(std.objectHas(request.supported, 'configmap.v1.')),
+      },
+    },
+  ],
+  status: { ready: true },
+}
+`,
+			},
+		},
+	}
+
+	var parent unstructured.Unstructured
+	parent.SetAPIVersion("example.com/v1")
+	parent.SetKind("App")
+	parent.SetName("web")
+	parent.SetNamespace("team-a")
+
+	out, err := render.Render(context.Background(), f, c, &parent)
+	require.NoError(t, err)
+	require.Len(t, out.Apply, 1)
+	require.Equal(t, map[string]interface{}{
+		"region":    "us-east1",
+		"replicas":  "3",
+		"supported": "true",
+	}, out.Apply[0].Object["data"])
+	require.Equal(t, map[string]interface{}{"ready": true}, out.Status)
+
+	parent.SetKind("Other")
+	_, err = render.Render(context.Background(), f, c, &parent)
+	require.Error(t, err)
+}
+
+func TestRunTest(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+
+	dir := t.TempDir()
+	caseDir := filepath.Join(dir, render.TestsDir, "basic")
+	require.NoError(t, os.MkdirAll(caseDir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(caseDir, "parent.yaml"), []byte(`
+apiVersion: example.com/v1
+kind: App
+metadata:
+  name: web
+`), 0644))
+
+	c := &apiv1.Controller{
+		Spec: apiv1.ControllerSpec{
+			For: apiv1.ResourceType{APIVersion: "example.com/v1", Kind: "App"},
+			Source: map[string]string{
+				"main.jsonnet": `function(request) { apply: [], status: { name: request.object.metadata.name } }`,
+			},
+		},
+	}
+
+	cases, err := render.DiscoverTests(dir)
+	require.NoError(t, err)
+	require.Len(t, cases, 1)
+
+	// Without an expected output the test fails.
+	res, err := render.RunTest(context.Background(), scheme, c, cases[0], false)
+	require.NoError(t, err)
+	require.False(t, res.Passed())
+	require.Contains(t, res.Diff, "+  name: web")
+
+	res, err = render.RunTest(context.Background(), scheme, c, cases[0], true)
+	require.NoError(t, err)
+	require.True(t, res.Updated)
+
+	res, err = render.RunTest(context.Background(), scheme, c, cases[0], false)
+	require.NoError(t, err)
+	require.True(t, res.Passed(), res.Diff)
+}
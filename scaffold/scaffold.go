@@ -0,0 +1,160 @@
+// Package scaffold generates the files of a new Controller, using the same
+// layout as the library Controllers.
+package scaffold
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/codeformio/declare/render"
+	templatefactory "github.com/codeformio/declare/template/factory"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+// Options configure the generated Controller.
+type Options struct {
+	// Kind of the parent type, i.e. "WebApp".
+	Kind string
+	// Group of the parent type, i.e. "apps.example.com".
+	Group string
+	// Version of the parent type. Defaults to "v1alpha1".
+	Version string
+	// Plural name of the parent type. Defaults to the lowercase kind + "s".
+	Plural string
+	// Language of the template, see templatefactory.Language. Defaults to
+	// jsonnet.
+	Language string
+}
+
+var (
+	kindPattern  = regexp.MustCompile(`^[A-Z][a-zA-Z0-9]*$`)
+	groupPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)+$`)
+)
+
+func (o *Options) complete() error {
+	if !kindPattern.MatchString(o.Kind) {
+		return fmt.Errorf("kind %q must be CamelCase, i.e. WebApp", o.Kind)
+	}
+	if !groupPattern.MatchString(o.Group) {
+		return fmt.Errorf("group %q must be a DNS subdomain, i.e. apps.example.com", o.Group)
+	}
+	if o.Version == "" {
+		o.Version = "v1alpha1"
+	}
+	if o.Plural == "" {
+		o.Plural = strings.ToLower(o.Kind) + "s"
+	}
+	switch o.Language {
+	case "", templatefactory.LangJSONNet:
+		o.Language = templatefactory.LangJSONNet
+	case templatefactory.LangJavascript, "js":
+		o.Language = templatefactory.LangJavascript
+	default:
+		return fmt.Errorf("unsupported language %q", o.Language)
+	}
+	return nil
+}
+
+// Files returns the generated files by their path (relative to the
+// directory of the Controller).
+func Files(opts Options) (map[string][]byte, error) {
+	if err := opts.complete(); err != nil {
+		return nil, err
+	}
+
+	source := map[string]string{
+		templatefactory.LangJSONNet:    jsonnetSource,
+		templatefactory.LangJavascript: javascriptSource,
+	}[opts.Language]
+	sourceFile := map[string]string{
+		templatefactory.LangJSONNet:    "controller.jsonnet",
+		templatefactory.LangJavascript: "controller.js",
+	}[opts.Language]
+
+	data := struct {
+		Options
+		Singular   string
+		SourceFile string
+		Source     string
+	}{
+		Options:    opts,
+		Singular:   strings.ToLower(opts.Kind),
+		SourceFile: sourceFile,
+		Source:     indent(source, 6),
+	}
+
+	files := make(map[string][]byte)
+	for name, tmpl := range templates {
+		name = strings.ReplaceAll(name, "SINGULAR", data.Singular)
+		var buf bytes.Buffer
+		if err := template.Must(template.New(name).Parse(tmpl)).Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("executing template %s: %w", name, err)
+		}
+		files[name] = buf.Bytes()
+	}
+
+	// The expected output of the test case is rendered from the generated
+	// Controller.
+	expected, err := renderExpected(files[render.ControllerFile], files[path.Join(render.TestsDir, "example", "parent.yaml")])
+	if err != nil {
+		return nil, fmt.Errorf("rendering test case: %w", err)
+	}
+	files[path.Join(render.TestsDir, "example", "expected.yaml")] = expected
+
+	return files, nil
+}
+
+// Paths returns the sorted paths of the files.
+func Paths(files map[string][]byte) []string {
+	var paths []string
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func renderExpected(controller, parent []byte) ([]byte, error) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	cObjs, err := render.DecodeManifests(bytes.NewReader(controller))
+	if err != nil {
+		return nil, err
+	}
+	var c apiv1.Controller
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(cObjs[0].Object, &c); err != nil {
+		return nil, err
+	}
+	pObjs, err := render.DecodeManifests(bytes.NewReader(parent))
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := render.Render(context.Background(), render.NewFixtures(scheme), &c, pObjs[0])
+	if err != nil {
+		return nil, err
+	}
+	return render.MarshalOutput(out)
+}
+
+func indent(s string, n int) string {
+	prefix := strings.Repeat(" ", n)
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = prefix + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
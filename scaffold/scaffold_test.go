@@ -0,0 +1,81 @@
+package scaffold_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	apiv1 "github.com/codeformio/declare/api/v1"
+	"github.com/codeformio/declare/lint"
+	"github.com/codeformio/declare/render"
+	"github.com/codeformio/declare/scaffold"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+func TestFiles(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, apiv1.AddToScheme(scheme))
+
+	for _, lang := range []string{"jsonnet", "javascript"} {
+		t.Run(lang, func(t *testing.T) {
+			files, err := scaffold.Files(scaffold.Options{Kind: "WebApp", Group: "apps.example.com", Language: lang})
+			require.NoError(t, err)
+			require.Equal(t, []string{
+				"controller.yaml",
+				"crd.yaml",
+				"example/webapp.yaml",
+				"kustomization.yaml",
+				"skaffold.yaml",
+				"tests/example/expected.yaml",
+				"tests/example/parent.yaml",
+			}, scaffold.Paths(files))
+
+			dir := t.TempDir()
+			for p, content := range files {
+				full := filepath.Join(dir, filepath.FromSlash(p))
+				require.NoError(t, os.MkdirAll(filepath.Dir(full), 0755))
+				require.NoError(t, ioutil.WriteFile(full, content, 0644))
+			}
+
+			c, err := render.ReadController(filepath.Join(dir, render.ControllerFile))
+			require.NoError(t, err)
+			require.Equal(t, "webapps", c.Name)
+			require.Equal(t, "apps.example.com/v1alpha1", c.Spec.For.APIVersion)
+
+			// The generated test case passes and the Controller lints clean.
+			cases, err := render.DiscoverTests(dir)
+			require.NoError(t, err)
+			require.Len(t, cases, 1)
+			res, err := render.RunTest(context.Background(), scheme, c, cases[0], false)
+			require.NoError(t, err)
+			require.True(t, res.Passed(), res.Diff)
+
+			findings, err := lint.Lint(context.Background(), scheme, c, dir)
+			require.NoError(t, err)
+			require.Empty(t, findings)
+
+			crd, err := render.ReadObject(filepath.Join(dir, "crd.yaml"))
+			require.NoError(t, err)
+			require.Equal(t, "webapps.apps.example.com", crd.GetName())
+		})
+	}
+}
+
+func TestFilesInvalidOptions(t *testing.T) {
+	cases := map[string]scaffold.Options{
+		"lowercaseKind": {Kind: "webapp", Group: "apps.example.com"},
+		"invalidGroup":  {Kind: "WebApp", Group: "Apps"},
+		"unknownLang":   {Kind: "WebApp", Group: "apps.example.com", Language: "python"},
+	}
+	for name, opts := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := scaffold.Files(opts)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package scaffold
+
+// templates of the generated files by path. "SINGULAR" in a path is replaced
+// with the lowercase kind.
+var templates = map[string]string{
+	"crd.yaml": `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  # name must match the spec fields below, and be in the form: <plural>.<group>
+  name: {{.Plural}}.{{.Group}}
+spec:
+  # group name to use for REST API: /apis/<group>/<version>
+  group: {{.Group}}
+  # list of versions supported by this CustomResourceDefinition
+  versions:
+    - name: {{.Version}}
+      # Each version can be enabled/disabled by Served flag.
+      served: true
+      # One and only one version must be marked as the storage version.
+      storage: true
+      subresources:
+        status: {}
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            spec:
+              type: object
+              required:
+              - image
+              properties:
+                image:
+                  type: string
+                replicas:
+                  type: integer
+                  minimum: 0
+                  default: 1
+                port:
+                  type: integer
+                  default: 8080
+            status:
+              type: object
+              x-kubernetes-preserve-unknown-fields: true
+  # either Namespaced or Cluster
+  scope: Namespaced
+  names:
+    # plural name to be used in the URL: /apis/<group>/<version>/<plural>
+    plural: {{.Plural}}
+    # singular name to be used as an alias on the CLI and for display
+    singular: {{.Singular}}
+    # kind is normally the CamelCased singular type. Your resource manifests use this.
+    kind: {{.Kind}}
+`,
+
+	"controller.yaml": `apiVersion: ctrl.declare.dev/v1
+kind: Controller
+metadata:
+  name: {{.Plural}}
+spec:
+  for:
+    apiVersion: {{.Group}}/{{.Version}}
+    kind: {{.Kind}}
+  dependencies:
+  - apiVersion: apps/v1
+    kind: Deployment
+    watch: true
+  - apiVersion: v1
+    kind: Service
+  namespacePolicy:
+    # Create children in the namespace of the {{.Kind}}.
+    sameNamespace: true
+  source:
+    {{.SourceFile}}: |
+{{.Source}}
+`,
+
+	"kustomization.yaml": `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+resources:
+- ./crd.yaml
+- ./controller.yaml
+`,
+
+	"skaffold.yaml": `apiVersion: skaffold/v2beta5
+kind: Config
+metadata:
+  name: {{.Plural}}
+deploy:
+  kustomize:
+    paths:
+    - .
+  kubectl:
+    manifests:
+    - example/
+`,
+
+	"example/SINGULAR.yaml": exampleInstance,
+
+	"tests/example/parent.yaml": exampleInstance,
+}
+
+const exampleInstance = `apiVersion: {{.Group}}/{{.Version}}
+kind: {{.Kind}}
+metadata:
+  name: hello
+spec:
+  image: nginx:1.19
+  replicas: 2
+  port: 80
+`
+
+const jsonnetSource = `function(request) {
+  local obj = request.object,
+  local labels = { app: obj.metadata.name },
+
+  local deployment = {
+    apiVersion: 'apps/v1',
+    kind: 'Deployment',
+    metadata: {
+      name: obj.metadata.name,
+      labels: labels,
+    },
+    spec: {
+      replicas: obj.spec.replicas,
+      selector: { matchLabels: labels },
+      template: {
+        metadata: { labels: labels },
+        spec: {
+          containers: [
+            {
+              name: 'app',
+              image: obj.spec.image,
+              ports: [{ name: 'http', containerPort: obj.spec.port }],
+            },
+          ],
+        },
+      },
+    },
+  },
+
+  local service = {
+    apiVersion: 'v1',
+    kind: 'Service',
+    metadata: {
+      name: obj.metadata.name,
+      labels: labels,
+    },
+    spec: {
+      selector: labels,
+      ports: [{ name: 'http', port: 80, targetPort: 'http' }],
+    },
+  },
+
+  apply: [deployment, service],
+}
+`
+
+const javascriptSource = `function sync(request) {
+  var obj = request.object;
+  var labels = { app: obj.metadata.name };
+
+  var deployment = {
+    apiVersion: "apps/v1",
+    kind: "Deployment",
+    metadata: {
+      name: obj.metadata.name,
+      labels: labels,
+    },
+    spec: {
+      replicas: obj.spec.replicas,
+      selector: { matchLabels: labels },
+      template: {
+        metadata: { labels: labels },
+        spec: {
+          containers: [
+            {
+              name: "app",
+              image: obj.spec.image,
+              ports: [{ name: "http", containerPort: obj.spec.port }],
+            },
+          ],
+        },
+      },
+    },
+  };
+
+  var service = {
+    apiVersion: "v1",
+    kind: "Service",
+    metadata: {
+      name: obj.metadata.name,
+      labels: labels,
+    },
+    spec: {
+      selector: labels,
+      ports: [{ name: "http", port: 80, targetPort: "http" }],
+    },
+  };
+
+  return { apply: [deployment, service] };
+}
+`
@@ -0,0 +1,125 @@
+package cue
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/load"
+	"github.com/codeformio/declare/template"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"k8s.io/apimachinery/pkg/util/json"
+)
+
+const (
+	// root is the (virtual) directory that the source files are loaded from.
+	root = "/declare"
+
+	// defaultModule is used when the source does not contain a
+	// cue.mod/module.cue file.
+	defaultModule = "declare.dev/controller"
+)
+
+// Templater evaluates CUE. The request is unified into the "request" field
+// and the "apply", "status" and "object" fields are extracted as the
+// output. Files in the cue.mod/ directory (i.e. cue.mod/gen/k8s.io/...) can be
+// imported, which allows children to be checked against schemas.
+type Templater struct {
+	Files map[string]string
+}
+
+func (t *Templater) Template(ctx context.Context, c client.Reader, input *template.Input) (*template.Output, error) {
+	overlay := map[string]load.Source{
+		path.Join(root, "cue.mod", "module.cue"): load.FromString(fmt.Sprintf("module: %q\n", defaultModule)),
+	}
+	// The files outside of cue.mod/ are loaded by name so that they do not
+	// need a package clause.
+	var files []string
+	for filename, src := range t.Files {
+		overlay[path.Join(root, filename)] = load.FromString(src)
+		if !strings.HasPrefix(path.Clean(filename), "cue.mod/") {
+			files = append(files, path.Join(root, filename))
+		}
+	}
+	sort.Strings(files)
+
+	insts := load.Instances(files, &load.Config{
+		Dir:        root,
+		ModuleRoot: root,
+		Overlay:    overlay,
+	})
+	if len(insts) != 1 {
+		return nil, fmt.Errorf("expected 1 instance, found %d", len(insts))
+	}
+	if err := insts[0].Err; err != nil {
+		return nil, fmt.Errorf("loading: %v", details(err))
+	}
+
+	var r cue.Runtime
+	inst, err := r.Build(insts[0])
+	if err != nil {
+		return nil, fmt.Errorf("building: %v", details(err))
+	}
+
+	request := make(map[string]interface{})
+	reqJsn, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling input to json: %w", err)
+	}
+	if err := json.Unmarshal(reqJsn, &request); err != nil {
+		return nil, fmt.Errorf("unmarshalling input from json: %w", err)
+	}
+
+	inst, err = inst.Fill(request, "request")
+	if err != nil {
+		return nil, fmt.Errorf("filling request: %v", details(err))
+	}
+
+	output := make(map[string]interface{})
+	for _, field := range []string{"apply", "status", "object"} {
+		v := inst.Lookup(field)
+		if !v.Exists() {
+			continue
+		}
+		if err := v.Validate(cue.Concrete(true)); err != nil {
+			return nil, fmt.Errorf("evaluating %s: %v", field, details(err))
+		}
+		var val interface{}
+		if err := v.Decode(&val); err != nil {
+			return nil, fmt.Errorf("decoding %s: %v", field, details(err))
+		}
+		output[field] = val
+	}
+
+	jsn, err := json.Marshal(output)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling output: %w", err)
+	}
+	var out template.Output
+	if err := json.Unmarshal(jsn, &out); err != nil {
+		return nil, fmt.Errorf("unmarshalling output: %w", err)
+	}
+
+	return &out, nil
+}
+
+// details returns all errors (with their positions) in a single line.
+func details(err error) string {
+	var msgs []string
+	for _, e := range errors.Errors(err) {
+		msg := e.Error()
+		if pos := e.Position(); pos.IsValid() {
+			msg = fmt.Sprintf("%s: %s", strings.TrimPrefix(pos.String(), root+"/"), msg)
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
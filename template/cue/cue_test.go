@@ -0,0 +1,115 @@
+package cue_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/codeformio/declare/template"
+	"github.com/codeformio/declare/template/cue"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestTemplate(t *testing.T) {
+	cases := []struct {
+		name   string
+		spec   map[string]interface{}
+		errors string
+	}{
+		{
+			name: "valid",
+			spec: map[string]interface{}{"replicas": 3},
+		},
+		{
+			name:   "invalidChild",
+			spec:   map[string]interface{}{"replicas": "three"},
+			errors: "apply.0.spec.replicas",
+		},
+	}
+
+	tmpl := cue.Templater{
+		Files: map[string]string{
+			"controller.cue": controllerSrc,
+			"cue.mod/gen/k8s.io/api/apps/v1/types.cue": appsSrc,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out, err := tmpl.Template(context.Background(), nil, &template.Input{
+				Object: &unstructured.Unstructured{
+					Object: map[string]interface{}{
+						"metadata": map[string]interface{}{
+							"name": "my-name",
+						},
+						"spec": c.spec,
+					},
+				},
+			})
+			if c.errors != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), c.errors)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Len(t, out.Apply, 1)
+			require.Equal(t, "my-name", out.Apply[0].GetName())
+			require.Equal(t, "Deployment", out.Apply[0].GetKind())
+			require.Equal(t, map[string]interface{}{"replicas": int64(3)}, out.Apply[0].Object["spec"])
+			require.Equal(t, map[string]interface{}{"ready": false}, out.Status)
+		})
+	}
+}
+
+func TestTemplateIncomplete(t *testing.T) {
+	tmpl := cue.Templater{
+		Files: map[string]string{
+			"controller.cue": `
+request: _
+apply: [{apiVersion: "v1", kind: "Service", metadata: name: string}]
+`,
+		},
+	}
+
+	_, err := tmpl.Template(context.Background(), nil, &template.Input{
+		Object: &unstructured.Unstructured{Object: map[string]interface{}{}},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "evaluating apply")
+}
+
+const controllerSrc = `
+package controller
+
+import appsv1 "k8s.io/api/apps/v1"
+
+request: {
+	object: {
+		metadata: name: string
+		spec: replicas: _
+	}
+	...
+}
+
+apply: [
+	appsv1.#Deployment & {
+		metadata: name: request.object.metadata.name
+		spec: replicas: request.object.spec.replicas
+	},
+]
+
+status: ready: false
+`
+
+const appsSrc = `
+package v1
+
+#Deployment: {
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	metadata: name: string
+	spec: replicas?: int
+}
+`
@@ -1,21 +1,100 @@
 package factory
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"path/filepath"
 
 	"github.com/codeformio/declare/template"
+	"github.com/codeformio/declare/template/cue"
+	"github.com/codeformio/declare/template/gotemplate"
+	"github.com/codeformio/declare/template/helm"
 	"github.com/codeformio/declare/template/javascript"
 	"github.com/codeformio/declare/template/jsonnet"
+	"github.com/codeformio/declare/template/kustomize"
+	"github.com/codeformio/declare/template/starlark"
+	"github.com/codeformio/declare/template/wasm"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 type Templater interface {
-	Template(client.Reader, *template.Input) (*template.Output, error)
+	Template(context.Context, client.Reader, *template.Input) (*template.Output, error)
 }
 
+// New returns a templater for the source files. The output is post-processed
+// by a kustomization if the source contains one (see kustomize.Split).
 func New(src map[string]string) (Templater, error) {
+	src, kfiles := kustomize.Split(src)
+	t, err := newLanguage(src)
+	if err != nil {
+		return nil, err
+	}
+	return kustomized(t, kfiles)
+}
+
+func newLanguage(src map[string]string) (Templater, error) {
+	lang, err := Language(src)
+	if err != nil {
+		return nil, err
+	}
+
+	switch lang {
+	case LangJSONNet:
+		return &jsonnet.Templater{Files: src}, nil
+	case LangJavascript:
+		return &javascript.Templater{Files: src}, nil
+	case LangCUE:
+		return &cue.Templater{Files: src}, nil
+	case LangStarlark:
+		return &starlark.Templater{Files: src}, nil
+	case LangGoTemplate:
+		return &gotemplate.Templater{Files: src}, nil
+	case LangWasm:
+		// Compiled once, the templater is cached with the Controller.
+		return wasm.New(src)
+	default:
+		return nil, errors.New("no supported languages found in source")
+	}
+}
+
+// NewChart returns a templater that renders a packaged Helm chart. The
+// source (if any) maps requests to the values of the chart.
+func NewChart(chart []byte, src map[string]string, opts helm.Options) (Templater, error) {
+	c, err := helm.LoadArchive(chart)
+	if err != nil {
+		return nil, err
+	}
+
+	src, kfiles := kustomize.Split(src)
+	t := &helm.Templater{Chart: c, Options: opts}
+	if len(src) > 0 {
+		values, err := newLanguage(src)
+		if err != nil {
+			return nil, err
+		}
+		t.Values = values
+	}
+
+	return kustomized(t, kfiles)
+}
+
+// kustomized wraps a templater with the kustomization in files (if any).
+func kustomized(t Templater, files map[string]string) (Templater, error) {
+	if files == nil {
+		return t, nil
+	}
+	k, err := kustomize.Load(files)
+	if err != nil {
+		return nil, err
+	}
+	return &kustomize.Templater{Base: t, Kustomization: k}, nil
+}
+
+// Language detects the language of the source files (ignoring a
+// kustomization).
+func Language(src map[string]string) (string, error) {
+	src, _ = kustomize.Split(src)
 	var lang string
 	for filename, _ := range src {
 		currentLang := language(filename)
@@ -26,29 +105,36 @@ func New(src map[string]string) (Templater, error) {
 		}
 
 		if currentLang != lang {
-			return nil, fmt.Errorf("found mixed languages, %v & %v, only one is supported at a time", currentLang, lang)
+			return "", fmt.Errorf("found mixed languages, %v & %v, only one is supported at a time", currentLang, lang)
 		}
 	}
 
-	switch lang {
-	case langJSONNet:
-		return &jsonnet.Templater{Files: src}, nil
-	case langJavascript:
-		return &javascript.Templater{Files: src}, nil
-	default:
-		return nil, errors.New("no supported languages found in source")
-	}
+	return lang, nil
 }
 
+// Languages returned by Language.
 const (
-	langJavascript = "javascript"
-	langJSONNet    = "jsonnet"
+	LangJavascript = "javascript"
+	LangJSONNet    = "jsonnet"
+	LangCUE        = "cue"
+	LangStarlark   = "starlark"
+	LangGoTemplate = "gotemplate"
+	LangWasm       = "wasm"
+	// LangHelm is used for Controllers with a chart.
+	LangHelm = "helm"
+	// LangWebhook is used for Controllers with a webhook.
+	LangWebhook = "webhook"
 )
 
 func language(filename string) string {
 	return map[string]string{
-		".js":        langJavascript,
-		".jsonnet":   langJSONNet,
-		".libsonnet": langJSONNet,
+		".js":        LangJavascript,
+		".jsonnet":   LangJSONNet,
+		".libsonnet": LangJSONNet,
+		".cue":       LangCUE,
+		".star":      LangStarlark,
+		".tmpl":      LangGoTemplate, // i.e. "deployment.yaml.tmpl"
+		".gotmpl":    LangGoTemplate,
+		".wasm":      LangWasm,
 	}[filepath.Ext(filename)]
 }
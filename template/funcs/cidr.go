@@ -0,0 +1,104 @@
+package funcs
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+)
+
+func parseCIDR(args []interface{}) (*net.IPNet, error) {
+	s, err := str(args, 0, "cidr")
+	if err != nil {
+		return nil, err
+	}
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+	return network, nil
+}
+
+func cidrContains(args []interface{}) (interface{}, error) {
+	network, err := parseCIDR(args)
+	if err != nil {
+		return nil, err
+	}
+	s, err := str(args, 1, "ip")
+	if err != nil {
+		return nil, err
+	}
+	// Either an address or a network (that must be fully contained).
+	if ip := net.ParseIP(s); ip != nil {
+		return network.Contains(ip), nil
+	}
+	_, other, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing 'ip': %q is not an IP address or CIDR", s)
+	}
+	ones, _ := network.Mask.Size()
+	otherOnes, _ := other.Mask.Size()
+	return otherOnes >= ones && network.Contains(other.IP), nil
+}
+
+// cidrSubnet allocates the netNum'th subnet of a network with a prefix that
+// is newBits longer, i.e. cidrSubnet("10.0.0.0/16", 8, 2) is "10.0.2.0/24".
+func cidrSubnet(args []interface{}) (interface{}, error) {
+	network, err := parseCIDR(args)
+	if err != nil {
+		return nil, err
+	}
+	newBits, err := integer(args, 1, "newBits")
+	if err != nil {
+		return nil, err
+	}
+	netNum, err := integer(args, 2, "netNum")
+	if err != nil {
+		return nil, err
+	}
+
+	ones, bits := network.Mask.Size()
+	if newBits < 1 || ones+newBits > bits {
+		return nil, fmt.Errorf("can not extend a /%d prefix by %d bits", ones, newBits)
+	}
+	if netNum < 0 || big.NewInt(int64(netNum)).BitLen() > newBits {
+		return nil, fmt.Errorf("network number %d does not fit in %d bits", netNum, newBits)
+	}
+
+	ip := ipToInt(network.IP)
+	ip.Or(ip, new(big.Int).Lsh(big.NewInt(int64(netNum)), uint(bits-ones-newBits)))
+	subnet := &net.IPNet{IP: intToIP(ip, len(network.IP)), Mask: net.CIDRMask(ones+newBits, bits)}
+	return subnet.String(), nil
+}
+
+// cidrHost returns the hostNum'th address of a network, i.e.
+// cidrHost("10.0.2.0/24", 5) is "10.0.2.5".
+func cidrHost(args []interface{}) (interface{}, error) {
+	network, err := parseCIDR(args)
+	if err != nil {
+		return nil, err
+	}
+	hostNum, err := integer(args, 1, "hostNum")
+	if err != nil {
+		return nil, err
+	}
+
+	ones, bits := network.Mask.Size()
+	if hostNum < 0 || big.NewInt(int64(hostNum)).BitLen() > bits-ones {
+		return nil, fmt.Errorf("host number %d does not fit in a /%d network", hostNum, ones)
+	}
+
+	ip := ipToInt(network.IP)
+	ip.Or(ip, big.NewInt(int64(hostNum)))
+	return intToIP(ip, len(network.IP)).String(), nil
+}
+
+func ipToInt(ip net.IP) *big.Int {
+	return new(big.Int).SetBytes(ip)
+}
+
+func intToIP(n *big.Int, size int) net.IP {
+	b := n.Bytes()
+	ip := make(net.IP, size)
+	copy(ip[size-len(b):], b)
+	return ip
+}
@@ -0,0 +1,433 @@
+// Package funcs is the library of helper functions that is shared by the
+// template languages. Arguments and results are JSON values (nil, bool,
+// float64, string, []interface{} and map[string]interface{}) so that every
+// language can convert them the same way it converts the request.
+package funcs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+// Func is a helper function.
+type Func struct {
+	Name   string
+	Params []string
+	Fn     func(args []interface{}) (interface{}, error)
+}
+
+// Call checks the number of arguments and calls the function. Errors are
+// prefixed with the name of the function.
+func (f *Func) Call(args []interface{}) (interface{}, error) {
+	if len(args) != len(f.Params) {
+		return nil, fmt.Errorf("%s: expected %d arguments (%v), got %d", f.Name, len(f.Params), f.Params, len(args))
+	}
+	res, err := f.Fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Name, err)
+	}
+	return res, nil
+}
+
+// All are the helper functions, sorted by name.
+var All = []*Func{
+	{Name: "base64Decode", Params: []string{"str"}, Fn: base64Decode},
+	{Name: "base64Encode", Params: []string{"str"}, Fn: base64Encode},
+	{Name: "cidrContains", Params: []string{"cidr", "ip"}, Fn: cidrContains},
+	{Name: "cidrHost", Params: []string{"cidr", "hostNum"}, Fn: cidrHost},
+	{Name: "cidrSubnet", Params: []string{"cidr", "newBits", "netNum"}, Fn: cidrSubnet},
+	{Name: "durationSeconds", Params: []string{"duration"}, Fn: durationSeconds},
+	{Name: "hmacSha256", Params: []string{"key", "message"}, Fn: hmacSha256},
+	{Name: "jsonPath", Params: []string{"value", "path"}, Fn: jsonPath},
+	{Name: "mergePatch", Params: []string{"value", "patch"}, Fn: mergePatch},
+	{Name: "quantityAdd", Params: []string{"a", "b"}, Fn: quantityAdd},
+	{Name: "quantityCompare", Params: []string{"a", "b"}, Fn: quantityCompare},
+	{Name: "quantityMultiply", Params: []string{"quantity", "factor"}, Fn: quantityMultiply},
+	{Name: "quantityValue", Params: []string{"quantity"}, Fn: quantityValue},
+	{Name: "randomName", Params: []string{"seed", "length"}, Fn: randomName},
+	{Name: "regexFind", Params: []string{"pattern", "str"}, Fn: regexFind},
+	{Name: "regexMatch", Params: []string{"pattern", "str"}, Fn: regexMatch},
+	{Name: "regexReplace", Params: []string{"pattern", "str", "replacement"}, Fn: regexReplace},
+	{Name: "semverCompare", Params: []string{"a", "b"}, Fn: semverCompare},
+	{Name: "semverSatisfies", Params: []string{"version", "constraint"}, Fn: semverSatisfies},
+	{Name: "sha256", Params: []string{"str"}, Fn: sha256Hex},
+	{Name: "yamlParse", Params: []string{"str"}, Fn: yamlParse},
+	{Name: "yamlStringify", Params: []string{"value"}, Fn: yamlStringify},
+}
+
+// Get returns the function with a name (or nil).
+func Get(name string) *Func {
+	i := sort.Search(len(All), func(i int) bool { return All[i].Name >= name })
+	if i < len(All) && All[i].Name == name {
+		return All[i]
+	}
+	return nil
+}
+
+// Normalize converts a Go value to a JSON value (i.e. ints to float64).
+func Normalize(v interface{}) (interface{}, error) {
+	jsn, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var res interface{}
+	if err := json.Unmarshal(jsn, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func str(args []interface{}, i int, name string) (string, error) {
+	s, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected type %T for '%s' arg", args[i], name)
+	}
+	return s, nil
+}
+
+func num(args []interface{}, i int, name string) (float64, error) {
+	switch n := args[i].(type) {
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	}
+	return 0, fmt.Errorf("unexpected type %T for '%s' arg", args[i], name)
+}
+
+func integer(args []interface{}, i int, name string) (int, error) {
+	n, err := num(args, i, name)
+	if err != nil {
+		return 0, err
+	}
+	if n != float64(int(n)) {
+		return 0, fmt.Errorf("'%s' arg must be an integer, got %v", name, n)
+	}
+	return int(n), nil
+}
+
+func base64Encode(args []interface{}) (interface{}, error) {
+	s, err := str(args, 0, "str")
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.EncodeToString([]byte(s)), nil
+}
+
+func base64Decode(args []interface{}) (interface{}, error) {
+	s, err := str(args, 0, "str")
+	if err != nil {
+		return nil, err
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func sha256Hex(args []interface{}) (interface{}, error) {
+	s, err := str(args, 0, "str")
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func hmacSha256(args []interface{}) (interface{}, error) {
+	key, err := str(args, 0, "key")
+	if err != nil {
+		return nil, err
+	}
+	msg, err := str(args, 1, "message")
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(msg))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func yamlParse(args []interface{}) (interface{}, error) {
+	s, err := str(args, 0, "str")
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+		return nil, err
+	}
+	return Normalize(v)
+}
+
+func yamlStringify(args []interface{}) (interface{}, error) {
+	b, err := yaml.Marshal(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// semverCompare returns -1, 0 or 1.
+func semverCompare(args []interface{}) (interface{}, error) {
+	var vs [2]*semver.Version
+	for i, name := range []string{"a", "b"} {
+		s, err := str(args, i, name)
+		if err != nil {
+			return nil, err
+		}
+		if vs[i], err = semver.NewVersion(s); err != nil {
+			return nil, fmt.Errorf("parsing '%s': %w", name, err)
+		}
+	}
+	return float64(vs[0].Compare(vs[1])), nil
+}
+
+func semverSatisfies(args []interface{}) (interface{}, error) {
+	s, err := str(args, 0, "version")
+	if err != nil {
+		return nil, err
+	}
+	c, err := str(args, 1, "constraint")
+	if err != nil {
+		return nil, err
+	}
+	v, err := semver.NewVersion(s)
+	if err != nil {
+		return nil, fmt.Errorf("parsing 'version': %w", err)
+	}
+	constraint, err := semver.NewConstraint(c)
+	if err != nil {
+		return nil, fmt.Errorf("parsing 'constraint': %w", err)
+	}
+	return constraint.Check(v), nil
+}
+
+func quantities(args []interface{}, names ...string) ([]resource.Quantity, error) {
+	qs := make([]resource.Quantity, len(names))
+	for i, name := range names {
+		var err error
+		switch v := args[i].(type) {
+		case string:
+			qs[i], err = resource.ParseQuantity(v)
+		default:
+			var n float64
+			if n, err = num(args, i, name); err == nil {
+				qs[i] = *resource.NewMilliQuantity(int64(n*1000), resource.DecimalSI)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing '%s': %w", name, err)
+		}
+	}
+	return qs, nil
+}
+
+// quantityValue returns the value of a quantity as a number, i.e. 0.5 for
+// "500m" and 134217728 for "128Mi".
+func quantityValue(args []interface{}) (interface{}, error) {
+	qs, err := quantities(args, "quantity")
+	if err != nil {
+		return nil, err
+	}
+	return float64(qs[0].MilliValue()) / 1000, nil
+}
+
+func quantityAdd(args []interface{}) (interface{}, error) {
+	qs, err := quantities(args, "a", "b")
+	if err != nil {
+		return nil, err
+	}
+	qs[0].Add(qs[1])
+	return qs[0].String(), nil
+}
+
+// quantityCompare returns -1, 0 or 1.
+func quantityCompare(args []interface{}) (interface{}, error) {
+	qs, err := quantities(args, "a", "b")
+	if err != nil {
+		return nil, err
+	}
+	return float64(qs[0].Cmp(qs[1])), nil
+}
+
+// quantityMultiply multiplies a quantity by a factor, rounding up to
+// milli-units and keeping the format of the quantity.
+func quantityMultiply(args []interface{}) (interface{}, error) {
+	qs, err := quantities(args, "quantity")
+	if err != nil {
+		return nil, err
+	}
+	factor, err := num(args, 1, "factor")
+	if err != nil {
+		return nil, err
+	}
+	q := qs[0]
+	milli := float64(q.MilliValue()) * factor
+	res := resource.NewMilliQuantity(int64(math.Ceil(milli)), q.Format)
+	return res.String(), nil
+}
+
+// durationSeconds parses a duration (i.e. "1h30m") as seconds.
+func durationSeconds(args []interface{}) (interface{}, error) {
+	s, err := str(args, 0, "duration")
+	if err != nil {
+		return nil, err
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, err
+	}
+	return d.Seconds(), nil
+}
+
+func regex(args []interface{}) (*regexp.Regexp, string, error) {
+	pattern, err := str(args, 0, "pattern")
+	if err != nil {
+		return nil, "", err
+	}
+	s, err := str(args, 1, "str")
+	if err != nil {
+		return nil, "", err
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, "", err
+	}
+	return re, s, nil
+}
+
+func regexMatch(args []interface{}) (interface{}, error) {
+	re, s, err := regex(args)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(s), nil
+}
+
+// regexFind returns the first match and its submatches (or null).
+func regexFind(args []interface{}) (interface{}, error) {
+	re, s, err := regex(args)
+	if err != nil {
+		return nil, err
+	}
+	m := re.FindStringSubmatch(s)
+	if m == nil {
+		return nil, nil
+	}
+	res := make([]interface{}, len(m))
+	for i := range m {
+		res[i] = m[i]
+	}
+	return res, nil
+}
+
+// regexReplace replaces all matches, the replacement can refer to
+// submatches ("$1").
+func regexReplace(args []interface{}) (interface{}, error) {
+	re, s, err := regex(args)
+	if err != nil {
+		return nil, err
+	}
+	repl, err := str(args, 2, "replacement")
+	if err != nil {
+		return nil, err
+	}
+	return re.ReplaceAllString(s, repl), nil
+}
+
+// nameAlphabet is the alphabet of generated names (the same as the one used
+// for generateName, without vowels to avoid words).
+const nameAlphabet = "bcdfghjklmnpqrstvwxz2456789"
+
+// randomName returns a name that looks random but only depends on the seed
+// (i.e. the UID of the parent) so that renders are stable.
+func randomName(args []interface{}) (interface{}, error) {
+	seed, err := str(args, 0, "seed")
+	if err != nil {
+		return nil, err
+	}
+	n, err := integer(args, 1, "length")
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 || n > 63 {
+		return nil, fmt.Errorf("'length' arg must be between 1 and 63, got %d", n)
+	}
+
+	name := make([]byte, 0, n)
+	sum := sha256.Sum256([]byte(seed))
+	for len(name) < n {
+		for _, b := range sum {
+			if len(name) == n {
+				break
+			}
+			name = append(name, nameAlphabet[int(b)%len(nameAlphabet)])
+		}
+		sum = sha256.Sum256(sum[:])
+	}
+	return string(name), nil
+}
+
+// jsonPath evaluates a kubectl style JSONPath expression (i.e.
+// "{.spec.containers[*].name}") and returns the list of results.
+func jsonPath(args []interface{}) (interface{}, error) {
+	path, err := str(args, 1, "path")
+	if err != nil {
+		return nil, err
+	}
+	jp := jsonpath.New("jsonPath").AllowMissingKeys(true)
+	if err := jp.Parse(path); err != nil {
+		return nil, err
+	}
+	results, err := jp.FindResults(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	res := []interface{}{}
+	for _, rs := range results {
+		for _, r := range rs {
+			res = append(res, r.Interface())
+		}
+	}
+	return Normalize(res)
+}
+
+// mergePatch applies a JSON merge patch (RFC 7386).
+func mergePatch(args []interface{}) (interface{}, error) {
+	doc, err := json.Marshal(args[0])
+	if err != nil {
+		return nil, err
+	}
+	patch, err := json.Marshal(args[1])
+	if err != nil {
+		return nil, err
+	}
+	merged, err := jsonpatch.MergePatch(doc, patch)
+	if err != nil {
+		return nil, err
+	}
+	var res interface{}
+	if err := json.Unmarshal(merged, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
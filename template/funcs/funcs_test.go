@@ -0,0 +1,107 @@
+package funcs_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/codeformio/declare/template/funcs"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuncs(t *testing.T) {
+	pod := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "web", "labels": map[string]interface{}{"app": "web"}},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "app", "image": "nginx"},
+				map[string]interface{}{"name": "sidecar", "image": "envoy"},
+			},
+		},
+	}
+
+	cases := []struct {
+		fn     string
+		args   []interface{}
+		output interface{}
+	}{
+		{"base64Encode", []interface{}{"hello"}, "aGVsbG8="},
+		{"base64Decode", []interface{}{"aGVsbG8="}, "hello"},
+		{"sha256", []interface{}{"hello"}, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"hmacSha256", []interface{}{"key", "hello"}, "9307b3b915efb5171ff14d8cb55fbcc798c6c0ef1456d66ded1a6aa723a58b7b"},
+		{"yamlParse", []interface{}{"a: 1\nb: [x]"}, map[string]interface{}{"a": float64(1), "b": []interface{}{"x"}}},
+		{"yamlStringify", []interface{}{map[string]interface{}{"a": float64(1)}}, "a: 1\n"},
+		{"semverCompare", []interface{}{"1.2.3", "1.10.0"}, float64(-1)},
+		{"semverCompare", []interface{}{"v2.0.0", "2.0.0"}, float64(0)},
+		{"semverSatisfies", []interface{}{"1.19.2", ">= 1.18, < 2"}, true},
+		{"semverSatisfies", []interface{}{"2.0.0", "~1.2"}, false},
+		{"cidrContains", []interface{}{"10.0.0.0/16", "10.0.3.4"}, true},
+		{"cidrContains", []interface{}{"10.0.0.0/16", "10.1.0.1"}, false},
+		{"cidrContains", []interface{}{"10.0.0.0/16", "10.0.2.0/24"}, true},
+		{"cidrContains", []interface{}{"10.0.0.0/16", "10.0.0.0/8"}, false},
+		{"cidrSubnet", []interface{}{"10.0.0.0/16", float64(8), float64(2)}, "10.0.2.0/24"},
+		{"cidrSubnet", []interface{}{"fd00::/48", float64(16), float64(258)}, "fd00:0:0:102::/64"},
+		{"cidrHost", []interface{}{"10.0.2.0/24", float64(5)}, "10.0.2.5"},
+		{"quantityValue", []interface{}{"500m"}, 0.5},
+		{"quantityValue", []interface{}{"128Mi"}, float64(134217728)},
+		{"quantityAdd", []interface{}{"500m", "1"}, "1500m"},
+		{"quantityAdd", []interface{}{"1Gi", "512Mi"}, "1536Mi"},
+		{"quantityCompare", []interface{}{"1Gi", "1000Mi"}, float64(1)},
+		{"quantityCompare", []interface{}{float64(2), "2000m"}, float64(0)},
+		{"quantityMultiply", []interface{}{"250m", float64(3)}, "750m"},
+		{"quantityMultiply", []interface{}{"1Gi", 1.5}, "1536Mi"},
+		{"durationSeconds", []interface{}{"1h30m"}, float64(5400)},
+		{"regexMatch", []interface{}{"^v[0-9]+$", "v12"}, true},
+		{"regexFind", []interface{}{"([a-z]+)-([0-9]+)", "web-42"}, []interface{}{"web-42", "web", "42"}},
+		{"regexFind", []interface{}{"[0-9]+", "web"}, nil},
+		{"regexReplace", []interface{}{"-([0-9]+)$", "web-42", ".$1"}, "web.42"},
+		{"randomName", []interface{}{"uid-1", float64(8)}, "2znhgbjp"},
+		{"jsonPath", []interface{}{pod, "{.spec.containers[*].name}"}, []interface{}{"app", "sidecar"}},
+		{"jsonPath", []interface{}{pod, "{.spec.missing}"}, []interface{}{}},
+		{"mergePatch", []interface{}{pod["metadata"], map[string]interface{}{"labels": map[string]interface{}{"app": nil, "tier": "web"}}},
+			map[string]interface{}{"name": "web", "labels": map[string]interface{}{"tier": "web"}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.fn, func(t *testing.T) {
+			fn := funcs.Get(c.fn)
+			require.NotNil(t, fn)
+			out, err := fn.Call(c.args)
+			require.NoError(t, err)
+			require.Equal(t, c.output, out)
+		})
+	}
+}
+
+func TestFuncsErrors(t *testing.T) {
+	cases := map[string]struct {
+		fn   string
+		args []interface{}
+	}{
+		"arity":            {"sha256", []interface{}{}},
+		"type":             {"sha256", []interface{}{float64(1)}},
+		"base64":           {"base64Decode", []interface{}{"%%%"}},
+		"semver":           {"semverCompare", []interface{}{"x", "1.0.0"}},
+		"cidr":             {"cidrContains", []interface{}{"10.0.0.0", "10.0.0.1"}},
+		"subnetTooSmall":   {"cidrSubnet", []interface{}{"10.0.0.0/30", float64(4), float64(0)}},
+		"netNumTooLarge":   {"cidrSubnet", []interface{}{"10.0.0.0/16", float64(2), float64(4)}},
+		"hostNumTooLarge":  {"cidrHost", []interface{}{"10.0.0.0/24", float64(256)}},
+		"quantity":         {"quantityAdd", []interface{}{"1x", "1"}},
+		"duration":         {"durationSeconds", []interface{}{"1 day"}},
+		"regex":            {"regexMatch", []interface{}{"(", "a"}},
+		"nameLength":       {"randomName", []interface{}{"seed", float64(0)}},
+		"nameLengthNotInt": {"randomName", []interface{}{"seed", 1.5}},
+		"jsonPath":         {"jsonPath", []interface{}{map[string]interface{}{}, "{.a"}},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := funcs.Get(c.fn).Call(c.args)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestAllSorted(t *testing.T) {
+	require.True(t, sort.SliceIsSorted(funcs.All, func(i, j int) bool { return funcs.All[i].Name < funcs.All[j].Name }))
+}
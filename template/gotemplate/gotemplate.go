@@ -0,0 +1,225 @@
+package gotemplate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	gotemplate "text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"github.com/codeformio/declare/template"
+	"github.com/codeformio/declare/template/funcs"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"k8s.io/apimachinery/pkg/util/json"
+)
+
+const (
+	// StatusFile is rendered into the status of the parent.
+	StatusFile = "status.yaml.tmpl"
+	// ObjectFile is rendered into the updates of the parent.
+	ObjectFile = "object.yaml.tmpl"
+)
+
+// Templater renders Go templates (with the Sprig functions) over the
+// request. Every file (except for the status and object files and files
+// starting with "_", which can hold shared definitions) renders a stream of
+// YAML documents that are applied.
+type Templater struct {
+	Files map[string]string
+}
+
+func (t *Templater) Template(ctx context.Context, c client.Reader, input *template.Input) (*template.Output, error) {
+	request := make(map[string]interface{})
+	reqJsn, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling input to json: %w", err)
+	}
+	if err := json.Unmarshal(reqJsn, &request); err != nil {
+		return nil, fmt.Errorf("unmarshalling input from json: %w", err)
+	}
+
+	var filenames []string
+	for filename := range t.Files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	root := gotemplate.New("").Option("missingkey=default")
+	root.Funcs(Funcs(ctx, c, root))
+	for _, filename := range filenames {
+		if _, err := root.New(filename).Parse(t.Files[filename]); err != nil {
+			return nil, err
+		}
+	}
+
+	output := map[string]interface{}{}
+	apply := []interface{}{}
+	for _, filename := range filenames {
+		if strings.HasPrefix(path.Base(filename), "_") {
+			continue
+		}
+
+		docs, err := Render(root, filename, request)
+		if err != nil {
+			return nil, err
+		}
+
+		switch path.Base(filename) {
+		case StatusFile, ObjectFile:
+			if len(docs) > 1 {
+				return nil, fmt.Errorf("%s: expected a single document, found %d", filename, len(docs))
+			}
+			if len(docs) == 1 {
+				output[strings.TrimSuffix(path.Base(filename), ".yaml.tmpl")] = docs[0]
+			}
+		default:
+			apply = append(apply, docs...)
+		}
+	}
+	output["apply"] = apply
+
+	jsn, err := json.Marshal(output)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling output: %w", err)
+	}
+	var out template.Output
+	if err := json.Unmarshal(jsn, &out); err != nil {
+		return nil, fmt.Errorf("unmarshalling output: %w", err)
+	}
+
+	return &out, nil
+}
+
+// Render executes a template and splits the result into YAML documents.
+// Empty documents are skipped.
+func Render(root *gotemplate.Template, name string, data interface{}) ([]interface{}, error) {
+	var buf bytes.Buffer
+	if err := root.ExecuteTemplate(&buf, name, data); err != nil {
+		return nil, err
+	}
+	// Like Helm, do not render missing values as "<no value>".
+	return Decode(name, strings.ReplaceAll(buf.String(), "<no value>", ""))
+}
+
+// Decode splits rendered YAML (or JSON) into documents. Empty documents are
+// skipped.
+func Decode(name, rendered string) ([]interface{}, error) {
+	var docs []interface{}
+	dec := utilyaml.NewYAMLOrJSONDecoder(strings.NewReader(rendered), 4096)
+	for {
+		var doc interface{}
+		if err := dec.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("%s: parsing rendered yaml: %w", name, err)
+		}
+		if doc == nil {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
+
+// Funcs returns the Sprig functions, the Helm style helpers and the helper
+// functions of the funcs package. Sprig functions with the same name (i.e.
+// regexMatch and semverCompare) are kept, so that Helm style templates render
+// the same: every helper can be called by name with helper, i.e.
+// helper "semverCompare" .a .b. Templates referenced by include are looked
+// up in root.
+func Funcs(ctx context.Context, c client.Reader, root *gotemplate.Template) gotemplate.FuncMap {
+	fm := SprigFuncs()
+
+	fm["toYaml"] = func(v interface{}) (string, error) {
+		y, err := yaml.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(string(y), "\n"), nil
+	}
+	fm["fromYaml"] = func(s string) (interface{}, error) {
+		var v interface{}
+		if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	fm["include"] = func(name string, data interface{}) (string, error) {
+		var buf bytes.Buffer
+		if err := root.ExecuteTemplate(&buf, name, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	fm["required"] = func(msg string, v interface{}) (interface{}, error) {
+		if v == nil {
+			return nil, errors.New(msg)
+		}
+		if s, ok := v.(string); ok && s == "" {
+			return nil, errors.New(msg)
+		}
+		return v, nil
+	}
+	fm["getObject"] = func(obj map[string]interface{}) (map[string]interface{}, error) {
+		return template.GetObject(ctx, c, obj)
+	}
+	fm["listObjects"] = func(apiVersion, kind string, args ...string) ([]interface{}, error) {
+		// The namespace and label selector are optional.
+		if len(args) > 2 {
+			return nil, fmt.Errorf("listObjects: expected at most 4 arguments, got %d", len(args)+2)
+		}
+		var namespace, labelSelector string
+		if len(args) > 0 {
+			namespace = args[0]
+		}
+		if len(args) > 1 {
+			labelSelector = args[1]
+		}
+		return template.ListObjects(ctx, c, apiVersion, kind, namespace, labelSelector)
+	}
+	for _, fn := range funcs.All {
+		if _, ok := fm[fn.Name]; !ok {
+			fm[fn.Name] = helper(fn)
+		}
+	}
+	fm["helper"] = func(name string, args ...interface{}) (interface{}, error) {
+		fn := funcs.Get(name)
+		if fn == nil {
+			return nil, fmt.Errorf("helper: unknown function %q", name)
+		}
+		return helper(fn)(args...)
+	}
+
+	return fm
+}
+
+// SprigFuncs returns the Sprig functions without the functions that read the
+// environment of the manager (env and expandenv), like Helm.
+func SprigFuncs() gotemplate.FuncMap {
+	fm := sprig.TxtFuncMap()
+	delete(fm, "env")
+	delete(fm, "expandenv")
+	return fm
+}
+
+// helper adapts a function of the shared helper library.
+func helper(fn *funcs.Func) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		// Numbers are float64 (as in the other languages).
+		in, err := funcs.Normalize(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.Name, err)
+		}
+		return fn.Call(in.([]interface{}))
+	}
+}
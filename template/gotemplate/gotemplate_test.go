@@ -0,0 +1,193 @@
+package gotemplate_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/codeformio/declare/template"
+	"github.com/codeformio/declare/template/gotemplate"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestTemplate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	c := fake.NewFakeClientWithScheme(scheme, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"},
+		Data:       map[string]string{"team": "web"},
+	})
+
+	tmpl := gotemplate.Templater{
+		Files: map[string]string{
+			"_helpers.tmpl":      helpersSrc,
+			"children.yaml.tmpl": childrenSrc,
+			"status.yaml.tmpl":   statusSrc,
+		},
+	}
+
+	out, err := tmpl.Template(context.Background(), c, &template.Input{
+		Object: &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name": "my-name",
+				},
+				"spec": map[string]interface{}{
+					"port": 80,
+				},
+			},
+		},
+	})
+
+	require.NoError(t, err)
+	require.Len(t, out.Apply, 2)
+	require.Equal(t, "Service", out.Apply[0].GetKind())
+	require.Equal(t, "my-name", out.Apply[0].GetName())
+	require.Equal(t, map[string]string{"app": "my-name", "team": "web"}, out.Apply[0].GetLabels())
+	require.Equal(t, "ConfigMap", out.Apply[1].GetKind())
+	require.Equal(t, map[string]interface{}{"port": "80", "encoded": "bXktbmFtZQ==", "missing": ""}, out.Apply[1].Object["data"])
+	require.Equal(t, map[string]interface{}{"ready": true}, out.Status)
+	require.Nil(t, out.Object)
+}
+
+func TestListObjects(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	c := fake.NewFakeClientWithScheme(scheme,
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default", Labels: map[string]string{"team": "web"}}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default", Labels: map[string]string{"team": "web"}}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "other", Labels: map[string]string{"team": "web"}}},
+	)
+
+	tmpl := gotemplate.Templater{
+		Files: map[string]string{
+			"status.yaml.tmpl": `
+web:
+{{- range listObjects "v1" "Secret" "default" "team=web" }}
+- {{ .metadata.name }}
+{{- end }}
+all: {{ len (listObjects "v1" "Secret") }}
+`,
+		},
+	}
+
+	out, err := tmpl.Template(context.Background(), c, &template.Input{
+		Object: &unstructured.Unstructured{Object: map[string]interface{}{}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"web": []interface{}{"a", "b"},
+		"all": float64(3),
+	}, out.Status)
+}
+
+func TestFuncs(t *testing.T) {
+	tmpl := gotemplate.Templater{
+		Files: map[string]string{
+			"status.yaml.tmpl": `
+host: {{ cidrHost .object.spec.cidr 10 }}
+name: {{ randomName .object.metadata.uid 8 }}
+{{- /* Sprig's semverCompare is kept. */}}
+supported: {{ semverCompare ">= 1.18" .object.spec.version }}
+{{- /* The helpers with the same name are called with helper. */}}
+newer: {{ helper "semverCompare" .object.spec.version "1.18.0" }}
+minor: {{ index (helper "regexFind" "^1\\.([0-9]+)" .object.spec.version) 1 }}
+fits: {{ le (quantityCompare .object.spec.cpu "2") 0.0 }}
+`,
+		},
+	}
+
+	out, err := tmpl.Template(context.Background(), nil, &template.Input{
+		Object: &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"uid": "uid-1"},
+			"spec":     map[string]interface{}{"cidr": "10.0.2.0/24", "version": "1.19.0", "cpu": "1500m"},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"host":      "10.0.2.10",
+		"name":      "2znhgbjp",
+		"supported": true,
+		"newer":     float64(1),
+		"minor":     float64(19),
+		"fits":      true,
+	}, out.Status)
+}
+
+func TestTemplateErrors(t *testing.T) {
+	cases := map[string]map[string]string{
+		"parseError":     {"main.yaml.tmpl": `{{ .object`},
+		"required":       {"main.yaml.tmpl": `name: {{ required "spec.name is required" .object.spec.name }}`},
+		"invalidYAML":    {"main.yaml.tmpl": "a: [b"},
+		"multipleStatus": {"status.yaml.tmpl": "a: 1\n---\nb: 2"},
+		"helperError":    {"main.yaml.tmpl": `a: {{ cidrHost "10.0.0.0" 1 }}`},
+		"unknownHelper":  {"main.yaml.tmpl": `a: {{ helper "missing" 1 }}`},
+	}
+
+	for name, files := range cases {
+		t.Run(name, func(t *testing.T) {
+			tmpl := gotemplate.Templater{Files: files}
+			_, err := tmpl.Template(context.Background(), nil, &template.Input{
+				Object: &unstructured.Unstructured{Object: map[string]interface{}{
+					"spec": map[string]interface{}{},
+				}},
+			})
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestEnvFuncs(t *testing.T) {
+	// The environment of the manager (i.e. credentials) can not be read.
+	for _, fn := range []string{"env", "expandenv"} {
+		tmpl := gotemplate.Templater{Files: map[string]string{
+			"main.yaml.tmpl": "a: {{ " + fn + ` "HOME" }}`,
+		}}
+		_, err := tmpl.Template(context.Background(), nil, &template.Input{
+			Object: &unstructured.Unstructured{Object: map[string]interface{}{}},
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `function "`+fn+`" not defined`)
+	}
+}
+
+const helpersSrc = `
+{{- define "labels" -}}
+app: {{ .object.metadata.name }}
+{{- $settings := getObject (dict "apiVersion" "v1" "kind" "ConfigMap" "metadata" (dict "name" "settings")) }}
+team: {{ $settings.data.team }}
+{{- end -}}
+`
+
+const childrenSrc = `
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{ .object.metadata.name }}
+  labels:
+    {{- include "labels" . | nindent 4 }}
+spec:
+  ports:
+  - port: {{ .object.spec.port }}
+---
+# Empty documents are skipped.
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .object.metadata.name }}
+data:
+  port: {{ .object.spec.port | quote }}
+  encoded: {{ .object.metadata.name | b64enc }}
+  missing: "{{ .object.spec.missing }}"
+`
+
+const statusSrc = `
+ready: {{ hasKey .object.spec "port" }}
+`
@@ -0,0 +1,81 @@
+package helm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// maxArchiveSize bounds the uncompressed size of a packaged chart.
+const maxArchiveSize = 20 << 20
+
+// LoadArchive loads a packaged chart (.tgz) with the Helm chart loader.
+func LoadArchive(data []byte) (*chart.Chart, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("reading chart archive: %w", err)
+	}
+	defer gz.Close()
+	n, err := io.Copy(ioutil.Discard, io.LimitReader(gz, maxArchiveSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading chart archive: %w", err)
+	}
+	if n > maxArchiveSize {
+		return nil, fmt.Errorf("reading chart archive: exceeds %d bytes", maxArchiveSize)
+	}
+
+	c, err := loader.LoadArchive(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("loading chart: %w", err)
+	}
+	return c, nil
+}
+
+// copyChart copies a chart and its subcharts so that processing the
+// dependencies of the chart (which enables subcharts and imports values in
+// place) does not change the loaded chart.
+func copyChart(c *chart.Chart) *chart.Chart {
+	out := *c
+
+	md := *c.Metadata
+	md.Dependencies = make([]*chart.Dependency, len(c.Metadata.Dependencies))
+	for i, d := range c.Metadata.Dependencies {
+		dep := *d
+		md.Dependencies[i] = &dep
+	}
+	out.Metadata = &md
+	out.Values, _ = deepCopy(c.Values).(map[string]interface{})
+
+	deps := make([]*chart.Chart, len(c.Dependencies()))
+	for i, dep := range c.Dependencies() {
+		deps[i] = copyChart(dep)
+	}
+	out.SetDependencies(deps...)
+
+	return &out
+}
+
+// deepCopy copies the maps and slices of a value.
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			out[k] = deepCopy(e)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = deepCopy(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,243 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/codeformio/declare/template"
+	gotmpl "github.com/codeformio/declare/template/gotemplate"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"k8s.io/apimachinery/pkg/util/json"
+)
+
+// hookAnnotation marks the manifests of chart hooks (i.e. test Pods and
+// pre-install Jobs).
+const hookAnnotation = "helm.sh/hook"
+
+// kubeVersion is reported as .Capabilities.KubeVersion (the version of the
+// Kubernetes libraries the manager is built with).
+var kubeVersion = chartutil.KubeVersion{Version: "v1.18.8", Major: "1", Minor: "18"}
+
+// ValuesTemplater maps a request to the values of a chart (returned as
+// Output.Values).
+type ValuesTemplater interface {
+	Template(context.Context, client.Reader, *template.Input) (*template.Output, error)
+}
+
+// Options configure how a chart accesses the cluster. The zero value renders
+// charts like helm template (without a cluster).
+type Options struct {
+	// Types are the types of the children of the chart (the dependencies
+	// of the Controller). The supported types are reported by
+	// .Capabilities.APIVersions and are listed to find existing children.
+	Types []schema.GroupVersionKind
+	// Mapper tells namespaced from cluster scoped types: namespaced
+	// manifests without a namespace are placed in the namespace of the
+	// release. When nil, manifests are returned as rendered.
+	Mapper meta.RESTMapper
+	// Config is used by lookup to read objects from the API server. When
+	// nil, lookup returns empty results.
+	Config *rest.Config
+	// ChildReader lists the children of the parent to tell an upgrade from
+	// an install (.Release.IsUpgrade), it needs to index children by the
+	// UIDs of their owners (see template.OwnerIndex). When nil, releases
+	// are always installed.
+	ChildReader client.Reader
+}
+
+// Templater renders a Helm chart in-process with the Helm template engine.
+// The release is named after the parent and installed in the parent's
+// namespace.
+type Templater struct {
+	Chart *chart.Chart
+	// Values maps the request to the values of the chart. Any children or
+	// status it returns are kept. The .spec of the parent is used as the
+	// values when nil.
+	Values  ValuesTemplater
+	Options Options
+}
+
+// Close closes the values templater (see template.Close).
+func (t *Templater) Close(ctx context.Context) error {
+	return template.Close(ctx, t.Values)
+}
+
+func (t *Templater) Template(ctx context.Context, c client.Reader, input *template.Input) (*template.Output, error) {
+	out := &template.Output{}
+	var values map[string]interface{}
+	if t.Values != nil {
+		var err error
+		out, err = t.Values.Template(ctx, c, input)
+		if err != nil {
+			return nil, fmt.Errorf("mapping values: %w", err)
+		}
+		values, out.Values = out.Values, nil
+	} else if spec, ok := input.Object.Object["spec"].(map[string]interface{}); ok {
+		values = spec
+	}
+
+	upgrade, err := t.installed(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	release := chartutil.ReleaseOptions{
+		Name:      input.Object.GetName(),
+		Namespace: input.Object.GetNamespace(),
+		Revision:  1,
+		IsInstall: !upgrade,
+		IsUpgrade: upgrade,
+	}
+
+	manifests, err := t.render(values, release, t.apiVersions(input.Supported))
+	if err != nil {
+		return nil, err
+	}
+	out.Apply = append(out.Apply, manifests...)
+
+	return out, nil
+}
+
+// render renders the templates of the chart and its enabled subcharts (by
+// path) like helm install. Hooks are not run: hook manifests are dropped, so
+// that i.e. test Pods are not applied as children on every reconcile.
+func (t *Templater) render(values map[string]interface{}, release chartutil.ReleaseOptions, versions chartutil.VersionSet) ([]*unstructured.Unstructured, error) {
+	chrt := copyChart(t.Chart)
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+	if err := chartutil.ProcessDependencies(chrt, values); err != nil {
+		return nil, fmt.Errorf("processing dependencies: %w", err)
+	}
+
+	caps := &chartutil.Capabilities{
+		KubeVersion: kubeVersion,
+		APIVersions: versions,
+		HelmVersion: chartutil.DefaultCapabilities.HelmVersion,
+	}
+	vals, err := chartutil.ToRenderValues(chrt, values, release, caps)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := engine.RenderWithClient(chrt, vals, t.Options.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range rendered {
+		if path.Base(name) != "NOTES.txt" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var manifests []*unstructured.Unstructured
+	for _, name := range names {
+		docs, err := gotmpl.Decode(name, rendered[name])
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			obj, err := toUnstructured(doc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if _, ok := obj.GetAnnotations()[hookAnnotation]; ok {
+				continue
+			}
+			if obj.GetNamespace() == "" && t.namespaced(obj.GroupVersionKind()) {
+				obj.SetNamespace(release.Namespace)
+			}
+			manifests = append(manifests, obj)
+		}
+	}
+
+	return manifests, nil
+}
+
+// namespaced returns true if the type is known to be namespaced.
+func (t *Templater) namespaced(gvk schema.GroupVersionKind) bool {
+	if t.Options.Mapper == nil {
+		return false
+	}
+	mapping, err := t.Options.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		// Unknown types are reported when the manifest is applied.
+		return false
+	}
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace
+}
+
+// installed returns true if the parent owns any children (of the supported
+// types, in the namespace of the parent), which means that the release was
+// installed before.
+func (t *Templater) installed(ctx context.Context, input *template.Input) (bool, error) {
+	if t.Options.ChildReader == nil {
+		return false, nil
+	}
+	parent := input.Object
+	for _, gvk := range t.Options.Types {
+		if !input.Supported[template.SupportedKey(gvk)] {
+			continue
+		}
+		var list unstructured.UnstructuredList
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := t.Options.ChildReader.List(ctx, &list,
+			client.InNamespace(parent.GetNamespace()),
+			client.MatchingFields{template.OwnerIndex: string(parent.GetUID())},
+		); err != nil {
+			return false, fmt.Errorf("listing children %s: %w", template.RelatedKey(gvk), err)
+		}
+		for i := range list.Items {
+			if template.OwnedBy(&list.Items[i], parent) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// apiVersions returns the API versions ("group/version") and types
+// ("group/version/Kind") of the supported types of the chart.
+func (t *Templater) apiVersions(supported map[string]bool) chartutil.VersionSet {
+	seen := make(map[string]bool)
+	var versions chartutil.VersionSet
+	add := func(v string) {
+		if !seen[v] {
+			seen[v] = true
+			versions = append(versions, v)
+		}
+	}
+	for _, gvk := range t.Options.Types {
+		if !supported[template.SupportedKey(gvk)] {
+			continue
+		}
+		apiVersion := gvk.GroupVersion().String()
+		add(apiVersion)
+		add(apiVersion + "/" + gvk.Kind)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+func toUnstructured(doc interface{}) (*unstructured.Unstructured, error) {
+	jsn, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var obj unstructured.Unstructured
+	if err := obj.UnmarshalJSON(jsn); err != nil {
+		return nil, fmt.Errorf("rendered object: %w", err)
+	}
+	return &obj, nil
+}
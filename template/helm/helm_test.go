@@ -0,0 +1,348 @@
+package helm_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	"github.com/codeformio/declare/template"
+	"github.com/codeformio/declare/template/helm"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestTemplate(t *testing.T) {
+	sub := archive(t, "redis", map[string]string{
+		"Chart.yaml":           "apiVersion: v2\nname: redis\nversion: 1.0.0\n",
+		"values.yaml":          "port: 6379\n",
+		"templates/redis.yaml": redisSrc,
+	})
+	chart, err := helm.LoadArchive(archive(t, "web", map[string]string{
+		"Chart.yaml":                        webChart,
+		"values.yaml":                       webValues,
+		"templates/_helpers.tpl":            helpersSrc,
+		"templates/NOTES.txt":               "Installed {{ .Release.Name }}",
+		"templates/web.yaml":                webSrc,
+		"templates/hooks.yaml":              hooksSrc,
+		"files/index.html":                  "<h1>hello</h1>",
+		"charts/redis-1.0.0.tgz":            string(sub),
+		"charts/disabled/Chart.yaml":        "apiVersion: v2\nname: disabled\nversion: 1.0.0\n",
+		"charts/disabled/templates/cm.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: disabled\n",
+	}))
+	require.NoError(t, err)
+	require.Len(t, chart.Dependencies(), 2)
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+
+	tmpl := helm.Templater{Chart: chart, Options: helm.Options{
+		Types:  []schema.GroupVersionKind{{Group: "networking.k8s.io", Version: "v1beta1", Kind: "Ingress"}},
+		Mapper: mapper,
+	}}
+	out, err := tmpl.Template(context.Background(), nil, &template.Input{
+		Object: &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name":      "my-name",
+					"namespace": "my-ns",
+				},
+				"spec": map[string]interface{}{
+					"replicas": 3,
+					"redis":    map[string]interface{}{"enabled": true},
+				},
+			},
+		},
+		Supported: map[string]bool{"ingress.v1beta1.networking.k8s.io": true},
+	})
+	require.NoError(t, err)
+	require.Len(t, out.Apply, 3)
+
+	// Manifests are ordered by the path of their template.
+	redis := out.Apply[0]
+	require.Equal(t, "my-name-redis", redis.GetName())
+	require.Equal(t, map[string]interface{}{"port": "6379", "region": "eu"}, redis.Object["data"])
+
+	deploy := out.Apply[1]
+	require.Equal(t, "Deployment", deploy.GetKind())
+	require.Equal(t, "my-name-web", deploy.GetName())
+	require.Equal(t, "my-ns", deploy.GetNamespace())
+	require.Equal(t, map[string]string{"app": "web", "version": "2.1.0"}, deploy.GetLabels())
+	replicas, _, _ := unstructured.NestedInt64(deploy.Object, "spec", "replicas")
+	require.Equal(t, int64(3), replicas)
+	image, _, _ := unstructured.NestedString(deploy.Object, "spec", "image")
+	require.Equal(t, "nginx:2.1.0", image)
+
+	cm := out.Apply[2]
+	require.Equal(t, "ConfigMap", cm.GetKind())
+	// Namespaced manifests are placed in the namespace of the release.
+	require.Equal(t, "my-ns", cm.GetNamespace())
+	require.Equal(t, map[string]interface{}{
+		"index.html": "<h1>hello</h1>",
+		"ingress":    "true",
+		"greeting":   "hello my-name",
+		"install":    "true",
+		"lookup":     "0",
+	}, cm.Object["data"])
+}
+
+func TestTemplateRelease(t *testing.T) {
+	sub := archive(t, "redis", map[string]string{
+		"Chart.yaml":           "apiVersion: v2\nname: redis\nversion: 1.0.0\n",
+		"values.yaml":          "port: 6379\nexports:\n  defaults:\n    redisPort: 6379\n",
+		"templates/redis.yaml": redisSrc,
+	})
+	chart, err := helm.LoadArchive(archive(t, "web", map[string]string{
+		"Chart.yaml":             releaseChart,
+		"templates/release.yaml": releaseSrc,
+		"charts/redis-1.0.0.tgz": string(sub),
+	}))
+	require.NoError(t, err)
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	parent := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "my-name", "namespace": "my-ns", "uid": "parent-uid"},
+		"spec":     map[string]interface{}{"cache": map[string]interface{}{"port": 6380}},
+	}}
+	input := &template.Input{Object: parent, Supported: map[string]bool{"configmap.v1.": true}}
+	types := []schema.GroupVersionKind{{Version: "v1", Kind: "ConfigMap"}}
+
+	cases := []struct {
+		name     string
+		children []runtime.Object
+		install  string
+	}{
+		{name: "install", install: "true"},
+		{
+			name: "upgrade",
+			children: []runtime.Object{&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name: "my-name-release", Namespace: "my-ns",
+				OwnerReferences: []metav1.OwnerReference{{UID: "parent-uid"}},
+			}}},
+			install: "false",
+		},
+		{
+			name: "notOwned",
+			children: []runtime.Object{&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name: "other", Namespace: "my-ns",
+			}}},
+			install: "true",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tmpl := helm.Templater{Chart: chart, Options: helm.Options{
+				Types:       types,
+				ChildReader: fake.NewFakeClientWithScheme(scheme, c.children...),
+			}}
+			out, err := tmpl.Template(context.Background(), nil, input)
+			require.NoError(t, err)
+			require.Len(t, out.Apply, 2)
+
+			// The subchart is rendered under its alias, with its exported
+			// values imported.
+			cache := out.Apply[0]
+			require.Equal(t, "my-name-redis", cache.GetName())
+			require.Equal(t, "6380", cache.Object["data"].(map[string]interface{})["port"])
+
+			release := out.Apply[1]
+			require.Equal(t, map[string]interface{}{
+				"install":   c.install,
+				"redisPort": "6379",
+			}, release.Object["data"])
+		})
+	}
+
+	// Rendering does not change the loaded chart.
+	require.Len(t, chart.Dependencies(), 1)
+	require.Equal(t, "redis", chart.Metadata.Dependencies[0].Name)
+	require.Equal(t, []interface{}{"defaults"}, chart.Metadata.Dependencies[0].ImportValues)
+}
+
+func TestTemplateValues(t *testing.T) {
+	chart, err := helm.LoadArchive(archive(t, "web", map[string]string{
+		"Chart.yaml":         webChart,
+		"values.yaml":        webValues,
+		"templates/web.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Values.name }}\n",
+	}))
+	require.NoError(t, err)
+
+	values := valuesFunc(func(input *template.Input) *template.Output {
+		return &template.Output{
+			Status: map[string]interface{}{"mapped": true},
+			Values: map[string]interface{}{"name": input.Object.GetName() + "-mapped"},
+		}
+	})
+
+	tmpl := helm.Templater{Chart: chart, Values: values}
+	out, err := tmpl.Template(context.Background(), nil, &template.Input{
+		Object: &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "my-name"},
+		}},
+	})
+	require.NoError(t, err)
+	require.Len(t, out.Apply, 1)
+	require.Equal(t, "my-name-mapped", out.Apply[0].GetName())
+	require.Equal(t, map[string]interface{}{"mapped": true}, out.Status)
+	require.Nil(t, out.Values)
+}
+
+func TestLoadArchiveErrors(t *testing.T) {
+	cases := map[string][]byte{
+		"notGzip":      []byte("not a chart"),
+		"noChartYAML":  archive(t, "web", map[string]string{"values.yaml": "a: 1"}),
+		"noName":       archive(t, "web", map[string]string{"Chart.yaml": "version: 1.0.0"}),
+		"invalidValue": archive(t, "web", map[string]string{"Chart.yaml": webChart, "values.yaml": "a: ["}),
+	}
+
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := helm.LoadArchive(data)
+			require.Error(t, err)
+		})
+	}
+}
+
+type valuesFunc func(*template.Input) *template.Output
+
+func (f valuesFunc) Template(_ context.Context, _ client.Reader, input *template.Input) (*template.Output, error) {
+	return f(input), nil
+}
+
+// archive packages the files of a chart.
+func archive(t *testing.T, name string, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for path, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     name + "/" + path,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+const webChart = `
+apiVersion: v2
+name: web
+version: 0.1.0
+appVersion: 2.1.0
+dependencies:
+- name: redis
+  version: 1.0.0
+  condition: redis.enabled
+- name: disabled
+  version: 1.0.0
+  condition: disabled.enabled
+`
+
+const webValues = `
+replicas: 1
+greeting: "hello {{ .Release.Name }}"
+global:
+  region: eu
+redis:
+  enabled: false
+disabled:
+  enabled: false
+`
+
+const helpersSrc = `
+{{- define "web.labels" -}}
+app: {{ .Chart.Name }}
+version: {{ .Chart.AppVersion }}
+{{- end -}}
+`
+
+const webSrc = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Release.Name }}-{{ .Chart.Name }}
+  namespace: {{ .Release.Namespace }}
+  labels:
+    {{- include "web.labels" . | nindent 4 }}
+spec:
+  replicas: {{ .Values.replicas }}
+  image: nginx:{{ .Chart.AppVersion }}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-content
+data:
+  index.html: {{ .Files.Get "files/index.html" | quote }}
+  ingress: {{ .Capabilities.APIVersions.Has "networking.k8s.io/v1beta1/Ingress" | quote }}
+  greeting: {{ tpl .Values.greeting . | quote }}
+  install: {{ .Release.IsInstall | quote }}
+  lookup: {{ len (lookup "v1" "ConfigMap" .Release.Namespace "") | quote }}
+`
+
+// Hooks are not applied.
+const hooksSrc = `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: {{ .Release.Name }}-test
+  annotations:
+    helm.sh/hook: test
+---
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: {{ .Release.Name }}-migrate
+  annotations:
+    helm.sh/hook: pre-install,pre-upgrade
+`
+
+const releaseChart = `
+apiVersion: v2
+name: web
+version: 0.1.0
+dependencies:
+- name: redis
+  version: 1.0.0
+  alias: cache
+  import-values:
+  - defaults
+`
+
+const releaseSrc = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-release
+data:
+  install: {{ .Release.IsInstall | quote }}
+  redisPort: {{ .Values.redisPort | quote }}
+`
+
+const redisSrc = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-redis
+data:
+  port: {{ .Values.port | quote }}
+  region: {{ .Values.global.region }}
+`
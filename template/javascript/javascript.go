@@ -1,9 +1,12 @@
 package javascript
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/codeformio/declare/template"
+	"github.com/codeformio/declare/template/funcs"
+	"github.com/codeformio/declare/tracing"
 	"github.com/robertkrimen/otto"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -14,8 +17,16 @@ type Templater struct {
 	Files map[string]string
 }
 
-func (t *Templater) Template(c client.Reader, input *template.Input) (*template.Output, error) {
+func (t *Templater) Template(ctx context.Context, c client.Reader, input *template.Input) (*template.Output, error) {
 	vm := otto.New()
+	if err := vm.Set("listObjects", listObjects(ctx, c)); err != nil {
+		return nil, fmt.Errorf("setting listObjects: %w", err)
+	}
+	for _, fn := range funcs.All {
+		if err := vm.Set(fn.Name, helper(ctx, fn)); err != nil {
+			return nil, fmt.Errorf("setting %s: %w", fn.Name, err)
+		}
+	}
 
 	for fn, src := range t.Files {
 		if _, err := vm.Run(src); err != nil {
@@ -53,3 +64,80 @@ func (t *Templater) Template(c client.Reader, input *template.Input) (*template.
 
 	return &output, nil
 }
+
+// listObjects returns the listObjects(apiVersion, kind, namespace,
+// labelSelector) function. The namespace and label selector are optional,
+// objects are listed in all namespaces and match any labels by default.
+// Errors are thrown.
+func listObjects(ctx context.Context, c client.Reader) func(otto.FunctionCall) otto.Value {
+	return func(call otto.FunctionCall) otto.Value {
+		_, span := tracing.Tracer().Start(ctx, "javascript.listObjects")
+		defer span.End()
+
+		var args [4]string
+		for i := range args {
+			arg := call.Argument(i)
+			if arg.IsUndefined() || arg.IsNull() {
+				continue
+			}
+			if !arg.IsString() {
+				panic(call.Otto.MakeTypeError(fmt.Sprintf("listObjects: argument %d must be a string", i+1)))
+			}
+			args[i] = arg.String()
+		}
+
+		res, err := template.ListObjects(ctx, c, args[0], args[1], args[2], args[3])
+		if err != nil {
+			span.RecordError(err)
+			panic(call.Otto.MakeCustomError("Error", "listObjects: "+err.Error()))
+		}
+		jsn, err := json.Marshal(res)
+		if err != nil {
+			panic(call.Otto.MakeCustomError("Error", "listObjects: "+err.Error()))
+		}
+		val, err := call.Otto.Call("JSON.parse", nil, string(jsn))
+		if err != nil {
+			panic(call.Otto.MakeCustomError("Error", "listObjects: "+err.Error()))
+		}
+		return val
+	}
+}
+
+// helper returns a function of the shared helper library (see the funcs
+// package). Errors are thrown.
+func helper(ctx context.Context, fn *funcs.Func) func(otto.FunctionCall) otto.Value {
+	return func(call otto.FunctionCall) otto.Value {
+		_, span := tracing.Tracer().Start(ctx, "javascript."+fn.Name)
+		defer span.End()
+
+		throw := func(err error) {
+			span.RecordError(err)
+			panic(call.Otto.MakeCustomError("Error", err.Error()))
+		}
+
+		args := make([]interface{}, len(call.ArgumentList))
+		for i, arg := range call.ArgumentList {
+			exp, err := arg.Export()
+			if err != nil {
+				throw(fmt.Errorf("%s: exporting argument %d: %w", fn.Name, i+1, err))
+			}
+			if args[i], err = funcs.Normalize(exp); err != nil {
+				throw(fmt.Errorf("%s: argument %d: %w", fn.Name, i+1, err))
+			}
+		}
+
+		res, err := fn.Call(args)
+		if err != nil {
+			throw(err)
+		}
+		jsn, err := json.Marshal(res)
+		if err != nil {
+			throw(fmt.Errorf("%s: %w", fn.Name, err))
+		}
+		val, err := call.Otto.Call("JSON.parse", nil, string(jsn))
+		if err != nil {
+			throw(fmt.Errorf("%s: %w", fn.Name, err))
+		}
+		return val
+	}
+}
@@ -1,13 +1,19 @@
 package javascript_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/codeformio/declare/template"
 	"github.com/codeformio/declare/template/javascript"
 
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestTemplate(t *testing.T) {
@@ -18,7 +24,7 @@ func TestTemplate(t *testing.T) {
 		},
 	}
 
-	out, err := tmpl.Template(nil, &template.Input{
+	out, err := tmpl.Template(context.Background(), nil, &template.Input{
 		Object: &unstructured.Unstructured{
 			Object: map[string]interface{}{
 				"metadata": map[string]interface{}{
@@ -38,6 +44,92 @@ func TestTemplate(t *testing.T) {
 	// json.NewEncoder(os.Stdout).Encode(out)
 }
 
+func TestListObjects(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	c := fake.NewFakeClientWithScheme(scheme,
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default", Labels: map[string]string{"team": "web"}}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default", Labels: map[string]string{"team": "web"}}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "other", Labels: map[string]string{"team": "web"}}},
+	)
+
+	tmpl := javascript.Templater{
+		Files: map[string]string{
+			"main.js": `
+function sync(request) {
+  var web = listObjects('v1', 'Secret', 'default', 'team=web');
+  return {
+    status: {
+      web: web.map(function(s) { return s.metadata.name; }),
+      all: listObjects('v1', 'Secret').length,
+      error: fail(),
+    },
+  };
+}
+`,
+			"error.js": `
+function fail() {
+  try {
+    listObjects('v1', 'Secret', '', '!!!');
+  } catch (e) {
+    return e.message;
+  }
+}
+`,
+		},
+	}
+
+	out, err := tmpl.Template(context.Background(), c, &template.Input{
+		Object: &unstructured.Unstructured{Object: map[string]interface{}{}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"a", "b"}, out.Status["web"])
+	require.Equal(t, float64(3), out.Status["all"])
+	require.Contains(t, out.Status["error"], "listObjects: parsing label selector")
+}
+
+func TestFuncs(t *testing.T) {
+	tmpl := javascript.Templater{
+		Files: map[string]string{
+			"main.js": `
+function sync(request) {
+  var error;
+  try {
+    cidrSubnet('10.0.0.0/30', 4, 0);
+  } catch (e) {
+    error = e.message;
+  }
+  return {
+    status: {
+      subnet: cidrSubnet(request.object.spec.cidr, 8, 2),
+      names: jsonPath(request.object, '{.spec.ports[*].name}'),
+      labels: mergePatch({app: 'web', tier: 'a'}, {tier: null}),
+      error: error,
+    },
+  };
+}
+`,
+		},
+	}
+
+	out, err := tmpl.Template(context.Background(), nil, &template.Input{
+		Object: &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"cidr": "10.0.0.0/16",
+				"ports": []interface{}{
+					map[string]interface{}{"name": "http", "port": int64(80)},
+					map[string]interface{}{"name": "https", "port": int64(443)},
+				},
+			},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "10.0.2.0/24", out.Status["subnet"])
+	require.Equal(t, []interface{}{"http", "https"}, out.Status["names"])
+	require.Equal(t, map[string]interface{}{"app": "web"}, out.Status["labels"])
+	require.Contains(t, out.Status["error"], "cidrSubnet:")
+}
+
 const mainSrc = `
 function sync(request) {
   var obj = request.object;
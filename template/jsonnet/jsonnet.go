@@ -2,20 +2,17 @@ package jsonnet
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"strconv"
 
 	"github.com/codeformio/declare/template"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	"github.com/codeformio/declare/template/funcs"
+	"github.com/codeformio/declare/tracing"
 
 	"github.com/google/go-jsonnet"
 	"github.com/google/go-jsonnet/ast"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/json"
 )
 
@@ -23,12 +20,16 @@ type Templater struct {
 	Files map[string]string
 }
 
-func (t *Templater) Template(c client.Reader, input *template.Input) (*template.Output, error) {
+func (t *Templater) Template(ctx context.Context, c client.Reader, input *template.Input) (*template.Output, error) {
 	vm := jsonnet.MakeVM()
 	for _, ext := range extensions {
-		vm.NativeFunction(ext)
+		vm.NativeFunction(traced(ctx, ext))
 	}
-	vm.NativeFunction(getObjectExt(c))
+	for _, fn := range funcs.All {
+		vm.NativeFunction(traced(ctx, funcExt(fn)))
+	}
+	vm.NativeFunction(traced(ctx, getObjectExt(ctx, c)))
+	vm.NativeFunction(traced(ctx, listObjectsExt(ctx, c)))
 
 	jsonInput, err := json.Marshal(input)
 	if err != nil {
@@ -57,7 +58,7 @@ func (t *Templater) Template(c client.Reader, input *template.Input) (*template.
 // getObjectExt gets an object from the k8s API server.
 // It expectes an inputs like:
 // { apiVersion: "", kind: "", metadata: { name: "" } }
-func getObjectExt(c client.Reader) *jsonnet.NativeFunction {
+func getObjectExt(ctx context.Context, c client.Reader) *jsonnet.NativeFunction {
 	return &jsonnet.NativeFunction{
 		Name:   "getObject",
 		Params: ast.Identifiers{"obj"},
@@ -66,40 +67,80 @@ func getObjectExt(c client.Reader) *jsonnet.NativeFunction {
 			if !ok {
 				return nil, fmt.Errorf("unexpected type %T for 'obj' arg", args[0])
 			}
-			meta, ok := obj["metadata"].(map[string]interface{})
-			if !ok {
-				return nil, errors.New("'obj' arg missing .metadata object field")
-			}
-			name, ok := meta["name"].(string)
-			if !ok {
-				return nil, errors.New("'obj' arg missing .metadata.name string field")
-			}
-			namespace, ok := meta["namespace"].(string)
-			if !ok {
-				namespace = "default"
+			res, err := template.GetObject(ctx, c, obj)
+			if err != nil {
+				return nil, err
 			}
-			apiV, ok := obj["apiVersion"].(string)
-			if !ok {
-				return nil, errors.New("'obj' arg missing .apiVersion string field")
+
+			return cleanJSON(res), nil
+		},
+	}
+}
+
+// listObjectsExt lists objects from the k8s API server.
+// It expects inputs like:
+// ("v1", "Secret", "namespace", "app=web")
+// An empty namespace lists all namespaces and an empty label selector matches
+// all objects.
+func listObjectsExt(ctx context.Context, c client.Reader) *jsonnet.NativeFunction {
+	return &jsonnet.NativeFunction{
+		Name:   "listObjects",
+		Params: listObjectsParams,
+		Func: func(args []interface{}) (interface{}, error) {
+			var strs [4]string
+			for i, arg := range args {
+				str, ok := arg.(string)
+				if !ok {
+					return nil, fmt.Errorf("unexpected type %T for '%s' arg", arg, listObjectsParams[i])
+				}
+				strs[i] = str
 			}
-			kind, ok := obj["kind"].(string)
-			if !ok {
-				return nil, errors.New("'obj' arg missing .kind string field")
+			res, err := template.ListObjects(ctx, c, strs[0], strs[1], strs[2], strs[3])
+			if err != nil {
+				return nil, err
 			}
 
-			var res unstructured.Unstructured
-			res.SetGroupVersionKind(schema.FromAPIVersionAndKind(apiV, kind))
-			if err := c.Get(context.Background(), types.NamespacedName{
-				Name:      name,
-				Namespace: namespace,
-			}, &res); err != nil {
-				if apierrors.IsNotFound(err) {
-					return map[string]interface{}{}, nil
-				}
-				return nil, fmt.Errorf("getting object: %v", err)
+			return cleanJSON(res), nil
+		},
+	}
+}
+
+var listObjectsParams = ast.Identifiers{"apiVersion", "kind", "namespace", "labelSelector"}
+
+// funcExt adds a native function for a helper function of the shared
+// library (see the funcs package).
+func funcExt(fn *funcs.Func) *jsonnet.NativeFunction {
+	params := make(ast.Identifiers, len(fn.Params))
+	for i, p := range fn.Params {
+		params[i] = ast.Identifier(p)
+	}
+	return &jsonnet.NativeFunction{
+		Name:   fn.Name,
+		Params: params,
+		Func: func(args []interface{}) (interface{}, error) {
+			res, err := fn.Call(args)
+			if err != nil {
+				return nil, err
 			}
+			return cleanJSON(res), nil
+		},
+	}
+}
 
-			return cleanJSON(res.Object), nil
+// traced wraps a native function to record a span for every invocation.
+func traced(ctx context.Context, fn *jsonnet.NativeFunction) *jsonnet.NativeFunction {
+	return &jsonnet.NativeFunction{
+		Name:   fn.Name,
+		Params: fn.Params,
+		Func: func(args []interface{}) (interface{}, error) {
+			_, span := tracing.Tracer().Start(ctx, "jsonnet.native."+fn.Name)
+			defer span.End()
+
+			res, err := fn.Func(args)
+			if err != nil {
+				span.RecordError(err)
+			}
+			return res, err
 		},
 	}
 }
@@ -1,13 +1,19 @@
 package jsonnet_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/codeformio/declare/template"
 	"github.com/codeformio/declare/template/jsonnet"
 
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestTemplate(t *testing.T) {
@@ -17,7 +23,7 @@ func TestTemplate(t *testing.T) {
 		},
 	}
 
-	out, err := tmpl.Template(nil, &template.Input{
+	out, err := tmpl.Template(context.Background(), nil, &template.Input{
 		Object: &unstructured.Unstructured{
 			Object: map[string]interface{}{
 				"metadata": map[string]interface{}{
@@ -37,6 +43,76 @@ func TestTemplate(t *testing.T) {
 	// json.NewEncoder(os.Stdout).Encode(out)
 }
 
+func TestListObjects(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	c := fake.NewFakeClientWithScheme(scheme,
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default", Labels: map[string]string{"team": "web"}}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default", Labels: map[string]string{"team": "web"}}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "other", Labels: map[string]string{"team": "web"}}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "d", Namespace: "default", Labels: map[string]string{"team": "db"}}},
+	)
+
+	tmpl := jsonnet.Templater{
+		Files: map[string]string{
+			"source.jsonnet": `
+function(request) {
+  local list = std.native('listObjects'),
+  status: {
+    web: [s.metadata.name for s in list('v1', 'Secret', 'default', 'team=web')],
+    all: std.length(list('v1', 'Secret', '', '')),
+  },
+}
+`,
+		},
+	}
+
+	out, err := tmpl.Template(context.Background(), c, &template.Input{
+		Object: &unstructured.Unstructured{Object: map[string]interface{}{}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"web": []interface{}{"a", "b"},
+		"all": float64(4),
+	}, out.Status)
+}
+
+func TestFuncs(t *testing.T) {
+	tmpl := jsonnet.Templater{
+		Files: map[string]string{
+			"source.jsonnet": `
+function(request) {
+  status: {
+    hash: std.native('sha256')(request.object.metadata.name),
+    cpu: std.native('quantityAdd')(request.object.spec.cpu, '250m'),
+    config: std.native('yamlParse')('replicas: 3'),
+  },
+}
+`,
+		},
+	}
+
+	out, err := tmpl.Template(context.Background(), nil, &template.Input{
+		Object: &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "hello"},
+			"spec":     map[string]interface{}{"cpu": "1"},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"hash":   "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		"cpu":    "1250m",
+		"config": map[string]interface{}{"replicas": float64(3)},
+	}, out.Status)
+
+	tmpl.Files["source.jsonnet"] = `function(request) { status: { v: std.native('semverCompare')('x', '1.0.0') } }`
+	_, err = tmpl.Template(context.Background(), nil, &template.Input{
+		Object: &unstructured.Unstructured{Object: map[string]interface{}{}},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "semverCompare")
+}
+
 const source = `
 function(request) {
   local obj = request.object,
@@ -0,0 +1,242 @@
+// Package kustomize post-processes template output with a kustomization
+// stored in the source of a Controller. The kustomization is run in-process
+// with the kustomize API over an in-memory file system that holds the
+// children as an additional resource.
+package kustomize
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/codeformio/declare/template"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/yaml"
+)
+
+// Filenames of a kustomization (in order of precedence).
+var Filenames = []string{"kustomization.yaml", "kustomization.yml", "Kustomization"}
+
+// ChildrenFile is the resource of the kustomization that holds the children
+// in the output of the templater. It can not be used in the source.
+const ChildrenFile = "declare-children.yaml"
+
+// root is the (virtual) directory of the kustomization.
+const root = "/declare"
+
+// Kustomization is a kustomization and the files of the source that it
+// references.
+type Kustomization struct {
+	filename      string
+	kustomization types.Kustomization
+	files         map[string]string
+}
+
+// Split separates the kustomization (and the files it references, i.e.
+// patches) from the template source files. The kustomization files are nil
+// when there is no kustomization in the source.
+func Split(src map[string]string) (templates, kustomization map[string]string) {
+	filename := find(src)
+	if filename == "" {
+		return src, nil
+	}
+
+	// A kustomization that can not be parsed is reported by Load.
+	var k types.Kustomization
+	_ = yaml.Unmarshal([]byte(src[filename]), &k)
+	refs := references(&k)
+
+	templates = make(map[string]string)
+	kustomization = map[string]string{filename: src[filename]}
+	for name, content := range src {
+		if name == filename {
+			continue
+		}
+		if referenced(refs, name) {
+			kustomization[name] = content
+		} else {
+			templates[name] = content
+		}
+	}
+	return templates, kustomization
+}
+
+// Load parses the kustomization from the files returned by Split. All files
+// that the kustomization references need to be in the source (remote
+// resources are not supported).
+func Load(files map[string]string) (*Kustomization, error) {
+	filename := find(files)
+	if filename == "" {
+		return nil, fmt.Errorf("no kustomization found in source, expected one of: %s", strings.Join(Filenames, ", "))
+	}
+
+	k := &Kustomization{filename: filename, files: files}
+	if err := yaml.UnmarshalStrict([]byte(files[filename]), &k.kustomization); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if _, ok := files[ChildrenFile]; ok {
+		return nil, fmt.Errorf("%s is reserved for the children of the Controller", ChildrenFile)
+	}
+	for _, ref := range references(&k.kustomization) {
+		if !found(files, ref) {
+			return nil, fmt.Errorf("%s: file %q not found in source", filename, ref)
+		}
+	}
+
+	return k, nil
+}
+
+// find returns the filename of the kustomization in the files (or an empty
+// string).
+func find(files map[string]string) string {
+	for _, name := range Filenames {
+		if _, ok := files[name]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// references returns the paths of the files (or directories) that a
+// kustomization references. Inline patches are not references.
+func references(k *types.Kustomization) []string {
+	var refs []string
+	refs = append(refs, k.Resources...)
+	refs = append(refs, k.Bases...)
+	refs = append(refs, k.Components...)
+	refs = append(refs, k.Crds...)
+	refs = append(refs, k.Configurations...)
+	refs = append(refs, k.Generators...)
+	refs = append(refs, k.Transformers...)
+	refs = append(refs, k.Validators...)
+	for _, p := range k.PatchesStrategicMerge {
+		if !strings.Contains(string(p), "\n") {
+			refs = append(refs, string(p))
+		}
+	}
+	for _, p := range append(append([]types.Patch{}, k.PatchesJson6902...), k.Patches...) {
+		if p.Path != "" {
+			refs = append(refs, p.Path)
+		}
+	}
+	var generators []types.KvPairSources
+	for _, g := range k.ConfigMapGenerator {
+		generators = append(generators, g.KvPairSources)
+	}
+	for _, g := range k.SecretGenerator {
+		generators = append(generators, g.KvPairSources)
+	}
+	for _, g := range generators {
+		for _, f := range g.FileSources {
+			// Files can be given a key, i.e. "key=path".
+			refs = append(refs, f[strings.Index(f, "=")+1:])
+		}
+		refs = append(refs, g.EnvSources...)
+	}
+
+	for i := range refs {
+		refs[i] = path.Clean(refs[i])
+	}
+	return refs
+}
+
+// referenced returns true if the file is referenced (or is in a referenced
+// directory).
+func referenced(refs []string, name string) bool {
+	name = path.Clean(name)
+	for _, ref := range refs {
+		if name == ref || strings.HasPrefix(name, ref+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// found returns true if the referenced file (or directory) is in the files.
+func found(files map[string]string, ref string) bool {
+	for name := range files {
+		if referenced([]string{ref}, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply runs objects through the kustomization: the objects are added to its
+// resources. The kustomized objects (including the resources and generated
+// objects of the kustomization) are returned.
+func (k *Kustomization) Apply(objs []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	fs := filesys.MakeFsInMemory()
+	for name, content := range k.files {
+		if err := fs.WriteFile(path.Join(root, name), []byte(content)); err != nil {
+			return nil, err
+		}
+	}
+
+	kust := k.kustomization
+	if len(objs) > 0 {
+		var children strings.Builder
+		for _, obj := range objs {
+			y, err := yaml.Marshal(obj.Object)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s: %w", obj.GetKind(), obj.GetName(), err)
+			}
+			children.WriteString("---\n")
+			children.Write(y)
+		}
+		if err := fs.WriteFile(path.Join(root, ChildrenFile), []byte(children.String())); err != nil {
+			return nil, err
+		}
+		kust.Resources = append([]string{ChildrenFile}, kust.Resources...)
+	}
+	y, err := yaml.Marshal(kust)
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.WriteFile(path.Join(root, k.filename), y); err != nil {
+		return nil, err
+	}
+
+	m, err := krusty.MakeKustomizer(fs, krusty.MakeDefaultOptions()).Run(root)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*unstructured.Unstructured, 0, m.Size())
+	for _, r := range m.Resources() {
+		out = append(out, &unstructured.Unstructured{Object: r.Map()})
+	}
+	return out, nil
+}
+
+// Base is a templater whose output is kustomized.
+type Base interface {
+	Template(context.Context, client.Reader, *template.Input) (*template.Output, error)
+}
+
+// Templater runs the children in the output of a templater through a
+// kustomization.
+type Templater struct {
+	Base          Base
+	Kustomization *Kustomization
+}
+
+// Close closes the base templater (see template.Close).
+func (t *Templater) Close(ctx context.Context) error {
+	return template.Close(ctx, t.Base)
+}
+
+func (t *Templater) Template(ctx context.Context, c client.Reader, input *template.Input) (*template.Output, error) {
+	out, err := t.Base.Template(ctx, c, input)
+	if err != nil {
+		return nil, err
+	}
+	if out.Apply, err = t.Kustomization.Apply(out.Apply); err != nil {
+		return nil, fmt.Errorf("kustomizing: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,264 @@
+package kustomize_test
+
+import (
+	"testing"
+
+	"github.com/codeformio/declare/template/kustomize"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func TestSplit(t *testing.T) {
+	templates, files := kustomize.Split(map[string]string{"main.jsonnet": "{}"})
+	require.Equal(t, map[string]string{"main.jsonnet": "{}"}, templates)
+	require.Nil(t, files)
+
+	// Only the files referenced by the kustomization are split off.
+	templates, files = kustomize.Split(map[string]string{
+		"main.yaml.tmpl":     "{}",
+		"service.yaml":       "kind: Service",
+		"kustomization.yaml": "patchesStrategicMerge: [patch.yaml]\nresources: [base]",
+		"patch.yaml":         "kind: Deployment",
+		"base/cm.yaml":       "kind: ConfigMap",
+	})
+	require.Equal(t, map[string]string{"main.yaml.tmpl": "{}", "service.yaml": "kind: Service"}, templates)
+	require.Equal(t, map[string]string{
+		"kustomization.yaml": "patchesStrategicMerge: [patch.yaml]\nresources: [base]",
+		"patch.yaml":         "kind: Deployment",
+		"base/cm.yaml":       "kind: ConfigMap",
+	}, files)
+}
+
+func TestApply(t *testing.T) {
+	k, err := kustomize.Load(map[string]string{
+		"kustomization.yaml": kustomizationSrc,
+		"resources.yaml":     resourcesPatch,
+		"config.yaml":        configMapSrc,
+	})
+	require.NoError(t, err)
+
+	objs := []*unstructured.Unstructured{
+		object(t, deploymentSrc),
+		object(t, serviceSrc),
+		object(t, databaseSrc),
+	}
+	objs, err = k.Apply(objs)
+	require.NoError(t, err)
+
+	// The resources of the kustomization are added after the children.
+	expected := []*unstructured.Unstructured{
+		object(t, expectedDeploymentSrc),
+		object(t, expectedServiceSrc),
+		object(t, expectedDatabaseSrc),
+		object(t, expectedConfigMapSrc),
+	}
+	require.Len(t, objs, len(expected))
+	for i := range expected {
+		require.Equal(t, expected[i].Object, objs[i].Object)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	cases := map[string]map[string]string{
+		"missing":          {"patch.yaml": "kind: Deployment"},
+		"unknownField":     {"kustomization.yaml": "unknown: true"},
+		"missingPatchFile": {"kustomization.yaml": "patchesStrategicMerge: [missing.yaml]"},
+		"remoteResource":   {"kustomization.yaml": "resources: [github.com/example/config]"},
+		"reservedFile":     {"kustomization.yaml": "resources: []", kustomize.ChildrenFile: ""},
+	}
+
+	for name, files := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := kustomize.Load(files)
+			require.Error(t, err)
+		})
+	}
+}
+
+func object(t *testing.T, src string) *unstructured.Unstructured {
+	var obj unstructured.Unstructured
+	jsn, err := yaml.YAMLToJSON([]byte(src))
+	require.NoError(t, err)
+	require.NoError(t, obj.UnmarshalJSON(jsn))
+	return &obj
+}
+
+const kustomizationSrc = `
+apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+commonLabels:
+  team: web
+commonAnnotations:
+  owner: platform
+images:
+- name: nginx
+  newName: registry.example.com/nginx
+  newTag: "1.19"
+resources:
+- config.yaml
+patchesStrategicMerge:
+- resources.yaml
+patchesJson6902:
+- target:
+    group: apps
+    version: v1
+    kind: Deployment
+    name: hello
+  patch: |
+    - op: replace
+      path: /spec/replicas
+      value: 3
+patches:
+- target:
+    kind: Database
+    labelSelector: tier=data
+  patch: |
+    - op: add
+      path: /spec/backups
+      value: true
+`
+
+const resourcesPatch = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: hello
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        resources:
+          limits:
+            memory: 128Mi
+`
+
+const deploymentSrc = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: hello
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: hello
+  template:
+    metadata:
+      labels:
+        app: hello
+    spec:
+      containers:
+      - name: app
+        image: nginx:1.18
+      - name: sidecar
+        image: envoy:v1
+`
+
+const expectedDeploymentSrc = `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: hello
+  labels:
+    team: web
+  annotations:
+    owner: platform
+spec:
+  replicas: 3
+  selector:
+    matchLabels:
+      app: hello
+      team: web
+  template:
+    metadata:
+      labels:
+        app: hello
+        team: web
+      annotations:
+        owner: platform
+    spec:
+      containers:
+      - name: app
+        image: registry.example.com/nginx:1.19
+        resources:
+          limits:
+            memory: 128Mi
+      - name: sidecar
+        image: envoy:v1
+`
+
+const serviceSrc = `
+apiVersion: v1
+kind: Service
+metadata:
+  name: hello
+spec:
+  selector:
+    app: hello
+`
+
+const expectedServiceSrc = `
+apiVersion: v1
+kind: Service
+metadata:
+  name: hello
+  labels:
+    team: web
+  annotations:
+    owner: platform
+spec:
+  selector:
+    app: hello
+    team: web
+`
+
+const databaseSrc = `
+apiVersion: db.example.com/v1
+kind: Database
+metadata:
+  name: hello
+  labels:
+    tier: data
+spec:
+  size: 1Gi
+`
+
+const expectedDatabaseSrc = `
+apiVersion: db.example.com/v1
+kind: Database
+metadata:
+  name: hello
+  labels:
+    tier: data
+    team: web
+  annotations:
+    owner: platform
+spec:
+  size: 1Gi
+  backups: true
+`
+
+const configMapSrc = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: shared
+data:
+  a: b
+`
+
+const expectedConfigMapSrc = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: shared
+  labels:
+    team: web
+  annotations:
+    owner: platform
+data:
+  a: b
+`
@@ -0,0 +1,106 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// GetObject gets an object from the k8s API server for templates.
+// It expects an input like:
+// { apiVersion: "", kind: "", metadata: { name: "", namespace: "" } }
+// The namespace defaults to "default". An empty object is returned when the
+// object is not found.
+func GetObject(ctx context.Context, c client.Reader, obj map[string]interface{}) (map[string]interface{}, error) {
+	meta, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("'obj' arg missing .metadata object field")
+	}
+	name, ok := meta["name"].(string)
+	if !ok {
+		return nil, errors.New("'obj' arg missing .metadata.name string field")
+	}
+	namespace, ok := meta["namespace"].(string)
+	if !ok {
+		namespace = "default"
+	}
+	apiV, ok := obj["apiVersion"].(string)
+	if !ok {
+		return nil, errors.New("'obj' arg missing .apiVersion string field")
+	}
+	kind, ok := obj["kind"].(string)
+	if !ok {
+		return nil, errors.New("'obj' arg missing .kind string field")
+	}
+
+	var res unstructured.Unstructured
+	res.SetGroupVersionKind(schema.FromAPIVersionAndKind(apiV, kind))
+	if err := c.Get(ctx, types.NamespacedName{
+		Name:      name,
+		Namespace: namespace,
+	}, &res); err != nil {
+		if apierrors.IsNotFound(err) {
+			return map[string]interface{}{}, nil
+		}
+		return nil, fmt.Errorf("getting object: %v", err)
+	}
+
+	return res.Object, nil
+}
+
+// ListObjects lists objects for templates. An empty namespace lists objects
+// in all namespaces and an empty label selector matches all objects. The
+// objects are sorted by namespace and name so that output does not depend on
+// the order of the cache.
+func ListObjects(ctx context.Context, c client.Reader, apiVersion, kind, namespace, labelSelector string) ([]interface{}, error) {
+	if apiVersion == "" || kind == "" {
+		return nil, errors.New("apiVersion and kind are required")
+	}
+	selector, err := labels.Parse(labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("parsing label selector: %v", err)
+	}
+
+	var list unstructured.UnstructuredList
+	list.SetGroupVersionKind(schema.FromAPIVersionAndKind(apiVersion, kind+"List"))
+	if err := c.List(ctx, &list, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("listing objects: %w", err)
+	}
+
+	sort.Slice(list.Items, func(i, j int) bool {
+		a, b := list.Items[i], list.Items[j]
+		if a.GetNamespace() != b.GetNamespace() {
+			return a.GetNamespace() < b.GetNamespace()
+		}
+		return a.GetName() < b.GetName()
+	})
+
+	objs := make([]interface{}, len(list.Items))
+	for i := range list.Items {
+		objs[i] = list.Items[i].Object
+	}
+	return objs, nil
+}
+
+// OwnerIndex is the field index of the readers that list the children of a
+// parent (i.e. webhook.Options.ChildReader), it holds the UIDs of the owners
+// of an object.
+const OwnerIndex = "metadata.ownerReferences.uid"
+
+// OwnedBy returns true if the child has an owner reference to the parent.
+func OwnedBy(child, parent *unstructured.Unstructured) bool {
+	for _, ref := range child.GetOwnerReferences() {
+		if ref.UID == parent.GetUID() {
+			return true
+		}
+	}
+	return false
+}
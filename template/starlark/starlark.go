@@ -0,0 +1,328 @@
+package starlark
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/codeformio/declare/template"
+	"github.com/codeformio/declare/template/funcs"
+	"github.com/codeformio/declare/tracing"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkjson"
+	"go.starlark.net/starlarkstruct"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"k8s.io/apimachinery/pkg/util/json"
+)
+
+// maxExecutionSteps bounds the computation of a single evaluation.
+const maxExecutionSteps = 10000000
+
+// Templater evaluates Starlark. Exactly one file must define a
+// sync(request) function. Files can load each other with load("file.star",
+// "symbol").
+type Templater struct {
+	Files map[string]string
+}
+
+func (t *Templater) Template(ctx context.Context, c client.Reader, input *template.Input) (*template.Output, error) {
+	thread := &starlark.Thread{
+		Name:  "template",
+		Print: func(*starlark.Thread, string) {},
+	}
+	thread.SetMaxExecutionSteps(maxExecutionSteps)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+
+	l := &loader{
+		files:       t.Files,
+		predeclared: builtins(ctx, c),
+		modules:     make(map[string]*module),
+	}
+	thread.Load = l.load
+
+	var filenames []string
+	for filename := range t.Files {
+		if filepath.Ext(filename) == ".star" {
+			filenames = append(filenames, filename)
+		}
+	}
+	sort.Strings(filenames)
+
+	var sync starlark.Value
+	var syncFile string
+	for _, filename := range filenames {
+		globals, err := l.load(thread, filename)
+		if err != nil {
+			return nil, err
+		}
+		if fn, ok := globals["sync"]; ok {
+			if sync != nil {
+				return nil, fmt.Errorf("sync is defined in both %s and %s", syncFile, filename)
+			}
+			sync, syncFile = fn, filename
+		}
+	}
+	if sync == nil {
+		return nil, fmt.Errorf("no sync function defined")
+	}
+
+	jsn, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling input to json: %w", err)
+	}
+	request, err := fromJSON(thread, jsn)
+	if err != nil {
+		return nil, fmt.Errorf("converting input: %w", err)
+	}
+
+	val, err := starlark.Call(thread, sync, starlark.Tuple{request}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("sync(request): %w", evalError(err))
+	}
+
+	jsn, err = toJSON(thread, val)
+	if err != nil {
+		return nil, fmt.Errorf("converting return value: %w", err)
+	}
+
+	var output template.Output
+	if err := json.Unmarshal(jsn, &output); err != nil {
+		return nil, fmt.Errorf("unmarshalling json return value as expected output: %w", err)
+	}
+
+	return &output, nil
+}
+
+// module is the (cached) result of executing a file.
+type module struct {
+	globals starlark.StringDict
+	err     error
+}
+
+// loader loads files by name, executing every file at most once.
+type loader struct {
+	files       map[string]string
+	predeclared starlark.StringDict
+	modules     map[string]*module
+}
+
+func (l *loader) load(thread *starlark.Thread, filename string) (starlark.StringDict, error) {
+	m, ok := l.modules[filename]
+	if ok {
+		if m == nil {
+			return nil, fmt.Errorf("cycle in load graph involving %s", filename)
+		}
+		return m.globals, m.err
+	}
+
+	src, ok := l.files[filename]
+	if !ok {
+		return nil, fmt.Errorf("file %q not found in source", filename)
+	}
+
+	// Mark the file as loading to detect cycles.
+	l.modules[filename] = nil
+	globals, err := starlark.ExecFile(thread, filename, src, l.predeclared)
+	l.modules[filename] = &module{globals: globals, err: evalError(err)}
+
+	return globals, evalError(err)
+}
+
+// evalError adds the Starlark backtrace to evaluation errors.
+func evalError(err error) error {
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		return fmt.Errorf("%s", evalErr.Backtrace())
+	}
+	return err
+}
+
+// builtins returns the predeclared values: getObject, listObjects, the
+// helper functions of the funcs package and the json, yaml and base64
+// modules.
+func builtins(ctx context.Context, c client.Reader) starlark.StringDict {
+	predeclared := starlark.StringDict{
+		"getObject": starlark.NewBuiltin("getObject", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			_, span := tracing.Tracer().Start(ctx, "starlark.builtin.getObject")
+			defer span.End()
+
+			var obj *starlark.Dict
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &obj); err != nil {
+				return nil, err
+			}
+			jsn, err := toJSON(thread, obj)
+			if err != nil {
+				return nil, err
+			}
+			var in map[string]interface{}
+			if err := json.Unmarshal(jsn, &in); err != nil {
+				return nil, err
+			}
+
+			res, err := template.GetObject(ctx, c, in)
+			if err != nil {
+				span.RecordError(err)
+				return nil, err
+			}
+
+			if jsn, err = json.Marshal(res); err != nil {
+				return nil, err
+			}
+			return fromJSON(thread, jsn)
+		}),
+		"listObjects": starlark.NewBuiltin("listObjects", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			_, span := tracing.Tracer().Start(ctx, "starlark.builtin.listObjects")
+			defer span.End()
+
+			var apiVersion, kind, namespace, labelSelector string
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs,
+				"apiVersion", &apiVersion, "kind", &kind, "namespace?", &namespace, "labelSelector?", &labelSelector); err != nil {
+				return nil, err
+			}
+
+			res, err := template.ListObjects(ctx, c, apiVersion, kind, namespace, labelSelector)
+			if err != nil {
+				span.RecordError(err)
+				return nil, err
+			}
+
+			jsn, err := json.Marshal(res)
+			if err != nil {
+				return nil, err
+			}
+			return fromJSON(thread, jsn)
+		}),
+		"json": starlarkjson.Module,
+		"yaml": &starlarkstruct.Module{
+			Name: "yaml",
+			Members: starlark.StringDict{
+				"encode": starlark.NewBuiltin("yaml.encode", yamlEncode),
+				"decode": starlark.NewBuiltin("yaml.decode", yamlDecode),
+			},
+		},
+		"base64": &starlarkstruct.Module{
+			Name: "base64",
+			Members: starlark.StringDict{
+				"encode": starlark.NewBuiltin("base64.encode", base64Encode),
+				"decode": starlark.NewBuiltin("base64.decode", base64Decode),
+			},
+		},
+	}
+	for _, fn := range funcs.All {
+		predeclared[fn.Name] = helper(ctx, fn)
+	}
+	return predeclared
+}
+
+// helper returns a builtin for a function of the shared helper library.
+func helper(ctx context.Context, fn *funcs.Func) *starlark.Builtin {
+	return starlark.NewBuiltin(fn.Name, func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		_, span := tracing.Tracer().Start(ctx, "starlark.builtin."+fn.Name)
+		defer span.End()
+
+		if len(kwargs) > 0 {
+			return nil, fmt.Errorf("%s: unexpected keyword arguments", b.Name())
+		}
+		in := make([]interface{}, len(args))
+		for i, arg := range args {
+			jsn, err := toJSON(thread, arg)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", b.Name(), err)
+			}
+			var v interface{}
+			if err := json.Unmarshal(jsn, &v); err != nil {
+				return nil, fmt.Errorf("%s: %v", b.Name(), err)
+			}
+			// Numbers are float64 (as in the other languages).
+			if in[i], err = funcs.Normalize(v); err != nil {
+				return nil, fmt.Errorf("%s: %v", b.Name(), err)
+			}
+		}
+
+		res, err := fn.Call(in)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+
+		jsn, err := json.Marshal(res)
+		if err != nil {
+			return nil, err
+		}
+		return fromJSON(thread, jsn)
+	})
+}
+
+func yamlEncode(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var x starlark.Value
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &x); err != nil {
+		return nil, err
+	}
+	jsn, err := toJSON(thread, x)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", b.Name(), err)
+	}
+	y, err := yaml.JSONToYAML(jsn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", b.Name(), err)
+	}
+	return starlark.String(y), nil
+}
+
+func yamlDecode(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	jsn, err := yaml.YAMLToJSON([]byte(s))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", b.Name(), err)
+	}
+	return fromJSON(thread, jsn)
+}
+
+func base64Encode(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	return starlark.String(base64.StdEncoding.EncodeToString([]byte(s))), nil
+}
+
+func base64Decode(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	dec, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", b.Name(), err)
+	}
+	return starlark.String(dec), nil
+}
+
+// fromJSON converts JSON to a Starlark value.
+func fromJSON(thread *starlark.Thread, jsn []byte) (starlark.Value, error) {
+	return starlark.Call(thread, starlarkjson.Module.Members["decode"], starlark.Tuple{starlark.String(jsn)}, nil)
+}
+
+// toJSON converts a Starlark value to JSON.
+func toJSON(thread *starlark.Thread, v starlark.Value) ([]byte, error) {
+	s, err := starlark.Call(thread, starlarkjson.Module.Members["encode"], starlark.Tuple{v}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s.(starlark.String)), nil
+}
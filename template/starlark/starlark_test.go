@@ -0,0 +1,175 @@
+package starlark_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/codeformio/declare/template"
+	"github.com/codeformio/declare/template/starlark"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestTemplate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	c := fake.NewFakeClientWithScheme(scheme, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"},
+		Data:       map[string]string{"labels": "team: web\ntier: frontend\n"},
+	})
+
+	tmpl := starlark.Templater{
+		Files: map[string]string{
+			"controller.star": mainSrc,
+			"utils.star":      utilsSrc,
+		},
+	}
+
+	out, err := tmpl.Template(context.Background(), c, &template.Input{
+		Object: &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"name": "my-name",
+				},
+				"spec": map[string]interface{}{
+					"port": 80,
+				},
+			},
+		},
+	})
+
+	require.NoError(t, err)
+	require.Len(t, out.Apply, 1)
+	require.Equal(t, "my-name", out.Apply[0].GetName())
+	require.Equal(t, map[string]string{"team": "web", "tier": "frontend"}, out.Apply[0].GetLabels())
+	require.Equal(t, map[string]interface{}{"port": float64(80), "encoded": "bXktbmFtZQ==", "missing": true}, out.Status)
+}
+
+func TestListObjects(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	c := fake.NewFakeClientWithScheme(scheme,
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default", Labels: map[string]string{"team": "web"}}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default", Labels: map[string]string{"team": "web"}}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "other", Labels: map[string]string{"team": "web"}}},
+	)
+
+	tmpl := starlark.Templater{
+		Files: map[string]string{
+			"main.star": `
+def sync(request):
+    web = listObjects("v1", "Secret", "default", labelSelector="team=web")
+    return {"status": {
+        "web": [s["metadata"]["name"] for s in web],
+        "all": len(listObjects("v1", "Secret")),
+    }}
+`,
+		},
+	}
+
+	out, err := tmpl.Template(context.Background(), c, &template.Input{
+		Object: &unstructured.Unstructured{Object: map[string]interface{}{}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"web": []interface{}{"a", "b"},
+		"all": float64(3),
+	}, out.Status)
+}
+
+func TestFuncs(t *testing.T) {
+	tmpl := starlark.Templater{
+		Files: map[string]string{
+			"main.star": `
+def sync(request):
+    spec = request["object"]["spec"]
+    return {"status": {
+        "upgrade": semverSatisfies(spec["version"], ">= 1.18"),
+        "memory": quantityMultiply(spec["memory"], 2),
+        "timeout": durationSeconds(spec["timeout"]),
+        "name": regexReplace("[^a-z0-9]+", spec["title"].lower(), "-"),
+    }}
+`,
+		},
+	}
+
+	out, err := tmpl.Template(context.Background(), nil, &template.Input{
+		Object: &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"version": "1.19.0", "memory": "256Mi", "timeout": "2m", "title": "My App"},
+		}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"upgrade": true,
+		"memory":  "512Mi",
+		"timeout": float64(120),
+		"name":    "my-app",
+	}, out.Status)
+}
+
+func TestTemplateErrors(t *testing.T) {
+	cases := map[string]map[string]string{
+		"noSync":        {"main.star": `def other(request): return {}`},
+		"multipleSyncs": {"a.star": `def sync(request): return {}`, "b.star": `def sync(request): return {}`},
+		"loadCycle":     {"a.star": `load("b.star", "x")` + "\ndef sync(request): return {}", "b.star": `load("a.star", "y")` + "\nx = 1"},
+		"loadMissing":   {"main.star": `load("missing.star", "x")` + "\ndef sync(request): return {}"},
+		"runtimeError":  {"main.star": "def sync(request):\n  return request['missing']"},
+		"endless":       {"main.star": "def sync(request):\n  for i in range(1000000000):\n    pass\n  return {}"},
+		"helperError":   {"main.star": "def sync(request):\n  return {'status': {'v': semverCompare('x', '1.0.0')}}"},
+		"helperKwargs":  {"main.star": "def sync(request):\n  return {'status': {'v': sha256(str='x')}}"},
+	}
+
+	for name, files := range cases {
+		t.Run(name, func(t *testing.T) {
+			tmpl := starlark.Templater{Files: files}
+			_, err := tmpl.Template(context.Background(), nil, &template.Input{
+				Object: &unstructured.Unstructured{Object: map[string]interface{}{}},
+			})
+			require.Error(t, err)
+		})
+	}
+}
+
+const mainSrc = `
+load("utils.star", "has_port")
+
+def sync(request):
+    obj = request["object"]
+    settings = getObject({"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "settings"}})
+    missing = getObject({"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "missing"}})
+
+    apply = []
+    if has_port(obj):
+        apply.append({
+            "apiVersion": "v1",
+            "kind": "Service",
+            "metadata": {
+                "name": obj["metadata"]["name"],
+                "labels": yaml.decode(settings["data"]["labels"]),
+            },
+            "spec": {
+                "selector": {"app": obj["metadata"]["name"]},
+                "ports": [{"protocol": "TCP", "port": obj["spec"]["port"]}],
+            },
+        })
+
+    return {
+        "apply": apply,
+        "status": {
+            "port": json.decode(json.encode(obj["spec"]["port"])),
+            "encoded": base64.encode(obj["metadata"]["name"]),
+            "missing": missing == {},
+        },
+    }
+`
+
+const utilsSrc = `
+def has_port(obj):
+    return "port" in obj["spec"] and obj["spec"]["port"] > 0
+`
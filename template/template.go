@@ -1,19 +1,69 @@
 package template
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type Input struct {
 	Object *unstructured.Unstructured `json:"object"`
-	Config map[string]string          `json:"config"`
+	Config map[string]interface{}     `json:"config"`
 	// Supported is a map of child types that are supported.
 	// Key format = "<kind>.<version>.<group>".
 	Supported map[string]bool `json:"supported"`
+	// Related are the objects selected by the related types of the
+	// Controller, keyed by RelatedKey and RelatedName.
+	Related map[string]map[string]*unstructured.Unstructured `json:"related,omitempty"`
 }
 
 type Output struct {
 	Apply []*unstructured.Unstructured `json:"apply"`
-	// TODO: Should Object be here also to allow updating the .spec?
-	Status map[string]interface{} `json:"status"`
+	// Object is an optional set of updates to the parent object.
+	// Only .metadata.labels, .metadata.annotations and .spec are applied,
+	// the identity of the parent (apiVersion, kind, name, namespace) can not
+	// be changed.
+	Object *unstructured.Unstructured `json:"object,omitempty"`
+	Status map[string]interface{}     `json:"status"`
+	// Values are passed to the chart of the Controller (if any) instead of
+	// being applied.
+	Values map[string]interface{} `json:"values,omitempty"`
+}
+
+// Closer is implemented by templaters that hold resources (i.e. a compiled
+// module) which are released when the templater is no longer used.
+type Closer interface {
+	Close(context.Context) error
+}
+
+// Close closes a templater if it implements Closer.
+func Close(ctx context.Context, t interface{}) error {
+	if c, ok := t.(Closer); ok {
+		return c.Close(ctx)
+	}
+	return nil
+}
+
+// SupportedKey returns the key of a type in Input.Supported.
+func SupportedKey(gvk schema.GroupVersionKind) string {
+	return strings.ToLower(fmt.Sprintf("%s.%s.%s", gvk.Kind, gvk.Version, gvk.Group))
+}
+
+// RelatedKey returns the key of a type in Input.Related: "<Kind>.<apiVersion>"
+// (the same as metacontroller, i.e. "Deployment.apps/v1").
+func RelatedKey(gvk schema.GroupVersionKind) string {
+	apiVersion, kind := gvk.ToAPIVersionAndKind()
+	return kind + "." + apiVersion
+}
+
+// RelatedName returns the key of an object in Input.Related: the name, or
+// "<namespace>/<name>" for objects in another namespace than the parent.
+func RelatedName(obj *unstructured.Unstructured, parentNamespace string) string {
+	if ns := obj.GetNamespace(); ns != "" && ns != parentNamespace {
+		return ns + "/" + obj.GetName()
+	}
+	return obj.GetName()
 }
@@ -0,0 +1,141 @@
+//go:build wasip1
+
+// Command main is a test module, build with:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -o main.wasm .
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"unsafe"
+)
+
+//go:wasmimport declare get_object
+func getObject(reqPtr, reqLen, bufPtr, bufLen uint32) uint32
+
+//go:wasmimport declare list_objects
+func listObjects(reqPtr, reqLen, bufPtr, bufLen uint32) uint32
+
+//go:wasmimport declare call_func
+func callFunc(reqPtr, reqLen, bufPtr, bufLen uint32) uint32
+
+// hostCall calls a host function, retrying with a larger buffer when the
+// result does not fit.
+func hostCall(fn func(reqPtr, reqLen, bufPtr, bufLen uint32) uint32, req, res interface{}) {
+	jsn, _ := json.Marshal(req)
+	buf := make([]byte, 16)
+	for {
+		n := fn(
+			uint32(uintptr(unsafe.Pointer(&jsn[0]))), uint32(len(jsn)),
+			uint32(uintptr(unsafe.Pointer(&buf[0]))), uint32(len(buf)),
+		)
+		if int(n) > len(buf) {
+			buf = make([]byte, n)
+			continue
+		}
+		if err := json.Unmarshal(buf[:n], res); err != nil {
+			panic(err)
+		}
+		return
+	}
+}
+
+// get reads an object through the host.
+func get(obj map[string]interface{}) map[string]interface{} {
+	var res map[string]interface{}
+	hostCall(getObject, obj, &res)
+	return res
+}
+
+// list lists objects through the host.
+func list(apiVersion, kind, namespace, labelSelector string) []map[string]interface{} {
+	var res []map[string]interface{}
+	hostCall(listObjects, map[string]string{
+		"apiVersion":    apiVersion,
+		"kind":          kind,
+		"namespace":     namespace,
+		"labelSelector": labelSelector,
+	}, &res)
+	return res
+}
+
+// fn calls a helper function through the host.
+func fn(name string, args ...interface{}) interface{} {
+	var res interface{}
+	hostCall(callFunc, map[string]interface{}{"name": name, "args": args}, &res)
+	return res
+}
+
+func main() {
+	in, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		panic(err)
+	}
+	var request struct {
+		Object struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Spec map[string]interface{} `json:"spec"`
+		} `json:"object"`
+	}
+	if err := json.Unmarshal(in, &request); err != nil {
+		panic(err)
+	}
+
+	if request.Object.Spec["fail"] == true {
+		fmt.Fprintln(os.Stderr, "failing as requested")
+		os.Exit(3)
+	}
+	if request.Object.Spec["loop"] == true {
+		for {
+		}
+	}
+	if request.Object.Spec["spin"] == true {
+		for {
+			spin()
+		}
+	}
+	if request.Object.Spec["allocate"] == true {
+		// More than the memory limit of the runtime.
+		var chunks [][]byte
+		for i := 0; i < 512; i++ {
+			chunks = append(chunks, make([]byte, 1<<20))
+		}
+		fmt.Println(len(chunks))
+	}
+
+	settings := get(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "settings"},
+	})
+	data, _ := settings["data"].(map[string]interface{})
+	secrets := list("v1", "Secret", "default", "team=web")
+
+	json.NewEncoder(os.Stdout).Encode(map[string]interface{}{
+		"apply": []interface{}{
+			map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Service",
+				"metadata": map[string]interface{}{
+					"name":   request.Object.Metadata.Name,
+					"labels": map[string]interface{}{"team": data["team"]},
+				},
+			},
+		},
+		"status": map[string]interface{}{
+			"port":    request.Object.Spec["port"],
+			"secrets": len(secrets),
+			"subnet":  fn("cidrSubnet", "10.0.0.0/16", 8, 2),
+		},
+	})
+}
+
+// spin is a function call that is not inlined (to use fuel).
+//
+//go:noinline
+func spin() {}
@@ -0,0 +1,306 @@
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/codeformio/declare/template"
+	"github.com/codeformio/declare/template/funcs"
+	"github.com/codeformio/declare/tracing"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"k8s.io/apimachinery/pkg/util/json"
+)
+
+const (
+	// hostModule is the name of the module that host functions are imported
+	// from.
+	hostModule = "declare"
+
+	// maxMemoryPages bounds the memory of a module (64KiB pages, 256MiB).
+	maxMemoryPages = 4096
+
+	// maxStderr is the number of bytes of stderr included in errors.
+	maxStderr = 4096
+
+	// DefaultTimeout bounds the execution of a module.
+	DefaultTimeout = 10 * time.Second
+
+	// DefaultFuel bounds the number of function calls of an execution.
+	DefaultFuel = 100000000
+)
+
+// Templater runs a WASI module (the base64 encoded .wasm file of the source)
+// for every request. The module reads the request (JSON) from stdin and
+// writes the output (JSON) to stdout. Objects can be read with the imported
+// host functions:
+//
+//	declare.get_object(req_ptr, req_len, buf_ptr, buf_len: i32) -> i32
+//	declare.list_objects(req_ptr, req_len, buf_ptr, buf_len: i32) -> i32
+//
+// which read the object(s) described by the JSON at req_ptr (see
+// template.GetObject and template.ListObjects) and write the JSON of the
+// result to buf_ptr if it fits in buf_len. The helper functions of the funcs
+// package are called with declare.call_func (same signature). The length of the JSON is returned
+// so that the call can be retried with a larger buffer.
+type Templater struct {
+	// Timeout bounds the execution of the module.
+	Timeout time.Duration
+	// Fuel bounds the computation of the module: every call of a function
+	// of the module uses one unit. Loops that do not call functions are
+	// bounded by the timeout.
+	Fuel uint64
+
+	runtime wazero.Runtime
+	module  wazero.CompiledModule
+}
+
+// New compiles the module of the source files.
+func New(files map[string]string) (*Templater, error) {
+	var name, src string
+	for filename, content := range files {
+		if filepath.Ext(filename) != ".wasm" {
+			continue
+		}
+		if name != "" {
+			return nil, fmt.Errorf("expected a single .wasm file, found %s and %s", name, filename)
+		}
+		name, src = filename, content
+	}
+	if name == "" {
+		return nil, errors.New("no .wasm file found in source")
+	}
+
+	bin, err := base64.StdEncoding.DecodeString(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: decoding base64: %w", name, err)
+	}
+
+	// The functions of the module are compiled with a listener that meters
+	// the calls (see meter).
+	ctx := context.WithValue(context.Background(), experimental.FunctionListenerFactoryKey{}, meter{})
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithMemoryLimitPages(maxMemoryPages))
+
+	wasi_snapshot_preview1.MustInstantiate(ctx, r)
+	if _, err := r.NewHostModuleBuilder(hostModule).
+		NewFunctionBuilder().
+		WithFunc(hostFunc("get_object", getObject)).
+		WithParameterNames("req_ptr", "req_len", "buf_ptr", "buf_len").
+		Export("get_object").
+		NewFunctionBuilder().
+		WithFunc(hostFunc("list_objects", listObjects)).
+		WithParameterNames("req_ptr", "req_len", "buf_ptr", "buf_len").
+		Export("list_objects").
+		NewFunctionBuilder().
+		WithFunc(hostFunc("call_func", callFunc)).
+		WithParameterNames("req_ptr", "req_len", "buf_ptr", "buf_len").
+		Export("call_func").
+		Instantiate(ctx); err != nil {
+		return nil, fmt.Errorf("instantiating host functions: %w", err)
+	}
+
+	module, err := r.CompileModule(ctx, bin)
+	if err != nil {
+		return nil, fmt.Errorf("%s: compiling: %w", name, err)
+	}
+
+	return &Templater{Timeout: DefaultTimeout, Fuel: DefaultFuel, runtime: r, module: module}, nil
+}
+
+// Close releases the runtime and the compiled module. The templater can
+// not be used afterwards.
+func (t *Templater) Close(ctx context.Context) error {
+	return t.runtime.Close(ctx)
+}
+
+// callKey holds the call of a running module in its context.
+type callKey struct{}
+
+// call is the state of a single execution used by host functions.
+type call struct {
+	client client.Reader
+	err    error
+	// fuel is the number of function calls left.
+	fuel uint64
+}
+
+// meter is a function listener that uses the fuel of the call for every
+// function call and stops the module when it runs out.
+type meter struct{}
+
+func (m meter) NewListener(api.FunctionDefinition) experimental.FunctionListener {
+	return m
+}
+
+func (meter) Before(ctx context.Context, mod api.Module, _ api.FunctionDefinition, _ []uint64) context.Context {
+	cl, ok := ctx.Value(callKey{}).(*call)
+	if !ok || cl.err != nil {
+		return ctx
+	}
+	if cl.fuel == 0 {
+		cl.err = errors.New("module ran out of fuel")
+		// Closing the module stops the execution.
+		_ = mod.CloseWithExitCode(ctx, 1)
+		return ctx
+	}
+	cl.fuel--
+	return ctx
+}
+
+func (meter) After(context.Context, api.Module, api.FunctionDefinition, error, []uint64) {}
+
+func (t *Templater) Template(ctx context.Context, c client.Reader, input *template.Input) (*template.Output, error) {
+	in, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling input to json: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	cl := &call{client: c, fuel: t.Fuel}
+	ctx = context.WithValue(ctx, callKey{}, cl)
+
+	var stdout, stderr bytes.Buffer
+	mod, err := t.runtime.InstantiateModule(ctx, t.module, wazero.NewModuleConfig().
+		// Anonymous, to allow for concurrent instances.
+		WithName("").
+		WithStdin(bytes.NewReader(in)).
+		WithStdout(&stdout).
+		WithStderr(&stderr))
+	if mod != nil {
+		defer mod.Close(context.Background())
+	}
+	if cl.err != nil {
+		return nil, cl.err
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("module did not finish within %v", t.Timeout)
+		}
+		if exitErr, ok := err.(*sys.ExitError); ok {
+			err = fmt.Errorf("module exited with code %d", exitErr.ExitCode())
+		}
+		return nil, withStderr(err, stderr.Bytes())
+	}
+
+	var output template.Output
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return nil, withStderr(fmt.Errorf("unmarshalling stdout as expected output: %w", err), stderr.Bytes())
+	}
+
+	return &output, nil
+}
+
+// withStderr adds the end of stderr to an error.
+func withStderr(err error, stderr []byte) error {
+	if len(stderr) == 0 {
+		return err
+	}
+	if len(stderr) > maxStderr {
+		stderr = stderr[len(stderr)-maxStderr:]
+	}
+	return fmt.Errorf("%w: stderr: %s", err, bytes.TrimSpace(stderr))
+}
+
+// hostFunc returns a host function that calls fn with the JSON request at
+// req_ptr and writes the JSON of the result to buf_ptr if it fits in buf_len.
+// The length of the result is returned. Errors abort the module.
+func hostFunc(name string, fn func(ctx context.Context, c client.Reader, req []byte) (interface{}, error)) func(ctx context.Context, m api.Module, reqPtr, reqLen, bufPtr, bufLen uint32) uint32 {
+	return func(ctx context.Context, m api.Module, reqPtr, reqLen, bufPtr, bufLen uint32) uint32 {
+		cl := ctx.Value(callKey{}).(*call)
+
+		ctx, span := tracing.Tracer().Start(ctx, "wasm.host."+name)
+		defer span.End()
+
+		abort := func(err error) uint32 {
+			span.RecordError(err)
+			cl.err = fmt.Errorf("%s: %w", name, err)
+			// Closing the module stops the execution.
+			_ = m.CloseWithExitCode(ctx, 1)
+			return 0
+		}
+
+		req, ok := m.Memory().Read(reqPtr, reqLen)
+		if !ok {
+			return abort(errors.New("request out of range of memory"))
+		}
+
+		res, err := fn(ctx, cl.client, req)
+		if err != nil {
+			return abort(err)
+		}
+		jsn, err := json.Marshal(res)
+		if err != nil {
+			return abort(err)
+		}
+
+		if uint32(len(jsn)) <= bufLen {
+			if !m.Memory().Write(bufPtr, jsn) {
+				return abort(errors.New("buffer out of range of memory"))
+			}
+		}
+		return uint32(len(jsn))
+	}
+}
+
+// getObject implements declare.get_object, the request is an object like
+// {"apiVersion": ..., "kind": ..., "metadata": {"name": ..., "namespace": ...}}.
+func getObject(ctx context.Context, c client.Reader, req []byte) (interface{}, error) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal(req, &obj); err != nil {
+		return nil, fmt.Errorf("unmarshalling request: %w", err)
+	}
+	return template.GetObject(ctx, c, obj)
+}
+
+// listObjects implements declare.list_objects, the request is like
+// {"apiVersion": ..., "kind": ..., "namespace": ..., "labelSelector": ...}.
+func listObjects(ctx context.Context, c client.Reader, req []byte) (interface{}, error) {
+	var opts struct {
+		APIVersion    string `json:"apiVersion"`
+		Kind          string `json:"kind"`
+		Namespace     string `json:"namespace"`
+		LabelSelector string `json:"labelSelector"`
+	}
+	if err := json.Unmarshal(req, &opts); err != nil {
+		return nil, fmt.Errorf("unmarshalling request: %w", err)
+	}
+	return template.ListObjects(ctx, c, opts.APIVersion, opts.Kind, opts.Namespace, opts.LabelSelector)
+}
+
+// callFunc implements declare.call_func, the request is like
+// {"name": "cidrSubnet", "args": ["10.0.0.0/16", 8, 2]}.
+func callFunc(ctx context.Context, c client.Reader, req []byte) (interface{}, error) {
+	var fc struct {
+		Name string        `json:"name"`
+		Args []interface{} `json:"args"`
+	}
+	if err := json.Unmarshal(req, &fc); err != nil {
+		return nil, fmt.Errorf("unmarshalling request: %w", err)
+	}
+	fn := funcs.Get(fc.Name)
+	if fn == nil {
+		return nil, fmt.Errorf("unknown function %q", fc.Name)
+	}
+	// Numbers are float64 (as in the other languages).
+	args, err := funcs.Normalize(fc.Args)
+	if err != nil {
+		return nil, err
+	}
+	if args == nil {
+		args = []interface{}{}
+	}
+	return fn.Call(args.([]interface{}))
+}
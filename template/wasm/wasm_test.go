@@ -0,0 +1,118 @@
+package wasm_test
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codeformio/declare/template"
+	"github.com/codeformio/declare/template/wasm"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// build compiles the test module in testdata/ (which needs a Go toolchain
+// that supports GOOS=wasip1).
+func build(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "wasm")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	out := filepath.Join(dir, "main.wasm")
+	cmd := exec.Command("go", "build", "-o", out, ".")
+	cmd.Dir = "testdata"
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm", "GOFLAGS=-mod=mod")
+	if msg, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("building test module (requires GOOS=wasip1 support): %v: %s", err, msg)
+	}
+
+	bin, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(bin)
+}
+
+func TestTemplate(t *testing.T) {
+	mod := build(t)
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	c := fake.NewFakeClientWithScheme(scheme,
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"},
+			Data:       map[string]string{"team": "a-team-with-a-long-name-that-does-not-fit-the-first-buffer"},
+		},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default", Labels: map[string]string{"team": "web"}}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default", Labels: map[string]string{"team": "web"}}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "default"}},
+	)
+
+	tmpl, err := wasm.New(map[string]string{"main.wasm": mod})
+	require.NoError(t, err)
+
+	input := func(spec map[string]interface{}) *template.Input {
+		return &template.Input{
+			Object: &unstructured.Unstructured{Object: map[string]interface{}{
+				"metadata": map[string]interface{}{"name": "my-name"},
+				"spec":     spec,
+			}},
+		}
+	}
+
+	out, err := tmpl.Template(context.Background(), c, input(map[string]interface{}{"port": 80}))
+	require.NoError(t, err)
+	require.Len(t, out.Apply, 1)
+	require.Equal(t, "my-name", out.Apply[0].GetName())
+	require.Equal(t, map[string]string{"team": "a-team-with-a-long-name-that-does-not-fit-the-first-buffer"}, out.Apply[0].GetLabels())
+	require.Equal(t, map[string]interface{}{"port": float64(80), "secrets": float64(2), "subnet": "10.0.2.0/24"}, out.Status)
+
+	_, err = tmpl.Template(context.Background(), c, input(map[string]interface{}{"fail": true}))
+	require.EqualError(t, err, "module exited with code 3: stderr: failing as requested")
+
+	// The Go runtime of the module crashes when it can not grow the memory.
+	_, err = tmpl.Template(context.Background(), c, input(map[string]interface{}{"allocate": true}))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "module exited with code 2")
+
+	// Function calls use fuel.
+	tmpl.Fuel = 1000000
+	_, err = tmpl.Template(context.Background(), c, input(map[string]interface{}{"spin": true}))
+	require.EqualError(t, err, "module ran out of fuel")
+	_, err = tmpl.Template(context.Background(), c, input(map[string]interface{}{"port": 80}))
+	require.NoError(t, err)
+
+	tmpl.Timeout = 100 * time.Millisecond
+	_, err = tmpl.Template(context.Background(), c, input(map[string]interface{}{"loop": true}))
+	require.EqualError(t, err, "module did not finish within 100ms")
+
+	// The module can not be run once the templater is closed.
+	require.NoError(t, tmpl.Close(context.Background()))
+	_, err = tmpl.Template(context.Background(), c, input(map[string]interface{}{"port": 80}))
+	require.Error(t, err)
+}
+
+func TestNewErrors(t *testing.T) {
+	cases := map[string]map[string]string{
+		"noModule":       {"main.js": ""},
+		"multipleModule": {"a.wasm": "", "b.wasm": ""},
+		"notBase64":      {"main.wasm": "%%%"},
+		"invalidModule":  {"main.wasm": base64.StdEncoding.EncodeToString([]byte("not wasm"))},
+	}
+
+	for name, files := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := wasm.New(files)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/codeformio/declare/template"
+	"github.com/codeformio/declare/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"k8s.io/apimachinery/pkg/util/json"
+)
+
+// Formats of requests and responses.
+const (
+	// FormatDeclare sends the template input and expects the template output.
+	FormatDeclare = "declare"
+	// FormatMetacontroller sends the sync request of a metacontroller
+	// CompositeController and expects its response.
+	FormatMetacontroller = "metacontroller"
+)
+
+const (
+	DefaultTimeout = 10 * time.Second
+	DefaultRetries = 2
+
+	// maxResponseSize bounds the size of a response body.
+	maxResponseSize = 10 << 20
+	// maxErrorBody is the number of bytes of a response included in errors.
+	maxErrorBody = 1024
+)
+
+// Options configure a Templater.
+type Options struct {
+	URL     string
+	Format  string
+	Timeout time.Duration
+	Retries int
+	// CABundle (PEM) verifies the certificate of the endpoint, the system
+	// roots are used when empty.
+	CABundle []byte
+	// Insecure allows for plain http URLs. Requests hold the config of the
+	// parent (including the values of Secrets), so only https URLs are
+	// allowed by default.
+	Insecure bool
+
+	// Controller is sent as the controller of metacontroller requests.
+	Controller map[string]interface{}
+	// Children are the types of the children that are observed (owned by the
+	// parent, in the namespace of the parent) for metacontroller requests.
+	Children []schema.GroupVersionKind
+	// ChildReader lists the children of metacontroller requests, it needs
+	// to index children by the UIDs of their owners (see
+	// template.OwnerIndex). When nil, children are listed with the reader
+	// passed to Template.
+	ChildReader client.Reader
+}
+
+// Templater delegates rendering to an HTTP endpoint. Requests that fail with
+// a connection error or a 5xx response are retried.
+type Templater struct {
+	opts    Options
+	client  *http.Client
+	backoff time.Duration
+}
+
+// New returns a Templater for an endpoint. Zero values of the timeout and
+// format are defaulted.
+func New(opts Options) (*Templater, error) {
+	if opts.URL == "" {
+		return nil, errors.New("webhook url is required")
+	}
+	u, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing webhook url: %w", err)
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && opts.Insecure:
+	case u.Scheme == "http":
+		return nil, fmt.Errorf("webhook url %q is not https (requests hold the config of the parent, including secrets)", opts.URL)
+	default:
+		return nil, fmt.Errorf("unsupported webhook url scheme %q", u.Scheme)
+	}
+	if opts.Format == "" {
+		opts.Format = FormatDeclare
+	}
+	if opts.Format != FormatDeclare && opts.Format != FormatMetacontroller {
+		return nil, fmt.Errorf("unsupported webhook format %q", opts.Format)
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(opts.CABundle) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(opts.CABundle) {
+			return nil, errors.New("webhook caBundle does not contain any PEM encoded certificates")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &Templater{
+		opts:    opts,
+		client:  &http.Client{Transport: transport},
+		backoff: 200 * time.Millisecond,
+	}, nil
+}
+
+func (t *Templater) Template(ctx context.Context, c client.Reader, input *template.Input) (*template.Output, error) {
+	var req interface{} = input
+	if t.opts.Format == FormatMetacontroller {
+		children, err := t.observedChildren(ctx, c, input.Object)
+		if err != nil {
+			return nil, err
+		}
+		related := input.Related
+		if related == nil {
+			related = map[string]map[string]*unstructured.Unstructured{}
+		}
+		req = &syncRequest{
+			Controller: t.opts.Controller,
+			Parent:     input.Object,
+			Children:   children,
+			Related:    related,
+			Finalizing: input.Object.GetDeletionTimestamp() != nil,
+		}
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling request: %w", err)
+	}
+
+	resp, err := t.post(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.opts.Format == FormatMetacontroller {
+		var sync syncResponse
+		if err := json.Unmarshal(resp, &sync); err != nil {
+			return nil, fmt.Errorf("unmarshalling response as sync response: %w", err)
+		}
+		if sync.ResyncAfterSeconds != 0 {
+			return nil, errors.New("resyncAfterSeconds is not supported in sync responses")
+		}
+		if sync.Finalized {
+			return nil, errors.New("finalized is not supported in sync responses, finalizers are not added to parents")
+		}
+		return &template.Output{Apply: sync.Children, Status: sync.Status}, nil
+	}
+
+	var output template.Output
+	if err := json.Unmarshal(resp, &output); err != nil {
+		return nil, fmt.Errorf("unmarshalling response as expected output: %w", err)
+	}
+	return &output, nil
+}
+
+// post sends a request, retrying on connection errors and 5xx responses.
+func (t *Templater) post(ctx context.Context, body []byte) ([]byte, error) {
+	var err error
+	for attempt := 0; attempt <= t.opts.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(t.backoff << (attempt - 1)):
+			case <-ctx.Done():
+				return nil, fmt.Errorf("%w (after %d attempts)", err, attempt)
+			}
+		}
+
+		var resp []byte
+		var retry bool
+		resp, retry, err = t.do(ctx, body, attempt)
+		if err == nil {
+			return resp, nil
+		}
+		if !retry {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%w (after %d attempts)", err, t.opts.Retries+1)
+}
+
+// do sends a single request. Failures that can be retried are reported.
+func (t *Templater) do(ctx context.Context, body []byte, attempt int) ([]byte, bool, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "webhook.request", trace.WithAttributes(
+		attribute.Int("attempt", attempt),
+	))
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, t.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, true, fmt.Errorf("calling webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		span.RecordError(err)
+		return nil, true, fmt.Errorf("reading response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if len(b) > maxErrorBody {
+			b = b[:maxErrorBody]
+		}
+		err := fmt.Errorf("webhook responded with %s: %s", resp.Status, bytes.TrimSpace(b))
+		span.RecordError(err)
+		return nil, resp.StatusCode >= 500, err
+	}
+
+	return b, false, nil
+}
+
+// syncRequest is the request of a metacontroller CompositeController sync
+// hook.
+type syncRequest struct {
+	Controller map[string]interface{}                           `json:"controller"`
+	Parent     *unstructured.Unstructured                       `json:"parent"`
+	Children   map[string]map[string]*unstructured.Unstructured `json:"children"`
+	Related    map[string]map[string]*unstructured.Unstructured `json:"related"`
+	Finalizing bool                                             `json:"finalizing"`
+}
+
+// syncResponse is the response of a metacontroller CompositeController sync
+// hook. Responses that set resyncAfterSeconds or finalized are rejected as
+// they are not supported.
+type syncResponse struct {
+	Status             map[string]interface{}       `json:"status"`
+	Children           []*unstructured.Unstructured `json:"children"`
+	ResyncAfterSeconds float64                      `json:"resyncAfterSeconds"`
+	Finalized          bool                         `json:"finalized"`
+}
+
+// observedChildren returns the children owned by the parent (in the
+// namespace of the parent), keyed like the related objects of the input (see
+// template.RelatedKey).
+func (t *Templater) observedChildren(ctx context.Context, c client.Reader, parent *unstructured.Unstructured) (map[string]map[string]*unstructured.Unstructured, error) {
+	opts := []client.ListOption{client.InNamespace(parent.GetNamespace())}
+	if t.opts.ChildReader != nil {
+		c = t.opts.ChildReader
+		opts = append(opts, client.MatchingFields{template.OwnerIndex: string(parent.GetUID())})
+	}
+
+	children := make(map[string]map[string]*unstructured.Unstructured, len(t.opts.Children))
+	for _, gvk := range t.opts.Children {
+		key := template.RelatedKey(gvk)
+		children[key] = make(map[string]*unstructured.Unstructured)
+		if c == nil {
+			continue
+		}
+
+		var list unstructured.UnstructuredList
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := c.List(ctx, &list, opts...); err != nil {
+			return nil, fmt.Errorf("listing children %s: %w", key, err)
+		}
+		for i := range list.Items {
+			child := &list.Items[i]
+			if !template.OwnedBy(child, parent) {
+				continue
+			}
+			children[key][template.RelatedName(child, parent.GetNamespace())] = child
+		}
+	}
+	return children, nil
+}
@@ -0,0 +1,255 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/codeformio/declare/template"
+	"github.com/codeformio/declare/template/webhook"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func input() *template.Input {
+	return &template.Input{
+		Object: &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "example.com/v1",
+			"kind":       "Website",
+			"metadata":   map[string]interface{}{"name": "my-name", "namespace": "default", "uid": "parent-uid"},
+			"spec":       map[string]interface{}{"port": 80},
+		}},
+	}
+}
+
+func TestTemplateDeclare(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var in template.Input
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+		spec := in.Object.Object["spec"]
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"apply": []interface{}{map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]interface{}{"name": in.Object.GetName()},
+			}},
+			"status": spec,
+		})
+	}))
+	defer srv.Close()
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	tmpl, err := webhook.New(webhook.Options{URL: srv.URL, CABundle: ca})
+	require.NoError(t, err)
+
+	out, err := tmpl.Template(context.Background(), nil, input())
+	require.NoError(t, err)
+	require.Len(t, out.Apply, 1)
+	require.Equal(t, "my-name", out.Apply[0].GetName())
+	require.Equal(t, map[string]interface{}{"port": float64(80)}, out.Status)
+
+	// The certificate is not trusted without the CA bundle.
+	tmpl, err = webhook.New(webhook.Options{URL: srv.URL})
+	require.NoError(t, err)
+	_, err = tmpl.Template(context.Background(), nil, input())
+	require.Error(t, err)
+}
+
+func TestTemplateMetacontroller(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	owner := []metav1.OwnerReference{{APIVersion: "example.com/v1", Kind: "Website", Name: "my-name", UID: "parent-uid"}}
+	c := fake.NewFakeClientWithScheme(scheme,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owned", Namespace: "default", OwnerReferences: owner}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owned", Namespace: "other", OwnerReferences: owner}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "unowned", Namespace: "default"}},
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Controller map[string]interface{}                       `json:"controller"`
+			Parent     map[string]interface{}                       `json:"parent"`
+			Children   map[string]map[string]map[string]interface{} `json:"children"`
+			Related    map[string]interface{}                       `json:"related"`
+			Finalizing bool                                         `json:"finalizing"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "my-controller", req.Controller["metadata"].(map[string]interface{})["name"])
+		require.Equal(t, "Website", req.Parent["kind"])
+		// Only children in the namespace of the parent are observed.
+		require.Len(t, req.Children["ConfigMap.v1"], 1)
+		require.Contains(t, req.Children["ConfigMap.v1"], "owned")
+		require.NotNil(t, req.Related)
+		require.False(t, req.Finalizing)
+
+		w.Write([]byte(`{
+			"status": {"observed": 2},
+			"children": [{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "owned"}}]
+		}`))
+	}))
+	defer srv.Close()
+
+	tmpl, err := webhook.New(webhook.Options{
+		URL:      srv.URL,
+		Insecure: true,
+		Format:   webhook.FormatMetacontroller,
+		Controller: map[string]interface{}{
+			"apiVersion": "ctrl.declare.dev/v1",
+			"kind":       "Controller",
+			"metadata":   map[string]interface{}{"name": "my-controller"},
+		},
+		Children: []schema.GroupVersionKind{{Version: "v1", Kind: "ConfigMap"}},
+	})
+	require.NoError(t, err)
+
+	out, err := tmpl.Template(context.Background(), c, input())
+	require.NoError(t, err)
+	require.Len(t, out.Apply, 1)
+	require.Equal(t, "owned", out.Apply[0].GetName())
+	require.Equal(t, map[string]interface{}{"observed": float64(2)}, out.Status)
+}
+
+// childReader records the options of lists.
+type childReader struct {
+	client.Reader
+	opts client.ListOptions
+}
+
+func (r *childReader) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	r.opts.ApplyOptions(opts)
+	return r.Reader.List(ctx, list, opts...)
+}
+
+func TestTemplateMetacontrollerChildReader(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	children := &childReader{Reader: fake.NewFakeClientWithScheme(scheme)}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"children": []}`))
+	}))
+	defer srv.Close()
+
+	tmpl, err := webhook.New(webhook.Options{
+		URL:         srv.URL,
+		Insecure:    true,
+		Format:      webhook.FormatMetacontroller,
+		Children:    []schema.GroupVersionKind{{Version: "v1", Kind: "ConfigMap"}},
+		ChildReader: children,
+	})
+	require.NoError(t, err)
+
+	// Children are listed with the child reader by the owner index (and not
+	// with the reader of the template).
+	_, err = tmpl.Template(context.Background(), nil, input())
+	require.NoError(t, err)
+	require.Equal(t, "default", children.opts.Namespace)
+	require.Equal(t, template.OwnerIndex+"=parent-uid", children.opts.FieldSelector.String())
+}
+
+func TestTemplateMetacontrollerUnsupported(t *testing.T) {
+	cases := map[string]string{
+		"resyncAfterSeconds": `{"children": [], "resyncAfterSeconds": 30}`,
+		"finalized":          `{"children": [], "finalized": true}`,
+	}
+
+	for name, resp := range cases {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(resp))
+			}))
+			defer srv.Close()
+
+			tmpl, err := webhook.New(webhook.Options{URL: srv.URL, Insecure: true, Format: webhook.FormatMetacontroller})
+			require.NoError(t, err)
+			_, err = tmpl.Template(context.Background(), nil, input())
+			require.Error(t, err)
+			require.Contains(t, err.Error(), name)
+		})
+	}
+}
+
+func TestTemplateRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(`{"status": {"ok": true}}`))
+		}
+	}))
+	defer srv.Close()
+
+	tmpl, err := webhook.New(webhook.Options{URL: srv.URL, Insecure: true, Retries: 1})
+	require.NoError(t, err)
+	out, err := tmpl.Template(context.Background(), nil, input())
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"ok": true}, out.Status)
+	require.EqualValues(t, 2, atomic.LoadInt32(&calls))
+
+	// Client errors are not retried.
+	atomic.StoreInt32(&calls, 0)
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "invalid spec", http.StatusBadRequest)
+	}))
+	defer bad.Close()
+
+	tmpl, err = webhook.New(webhook.Options{URL: bad.URL, Insecure: true, Retries: 2})
+	require.NoError(t, err)
+	_, err = tmpl.Template(context.Background(), nil, input())
+	require.EqualError(t, err, "webhook responded with 400 Bad Request: invalid spec")
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+}
+
+func TestTemplateTimeout(t *testing.T) {
+	done := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	tmpl, err := webhook.New(webhook.Options{URL: srv.URL, Insecure: true, Timeout: 50 * time.Millisecond})
+	require.NoError(t, err)
+	_, err = tmpl.Template(context.Background(), nil, input())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "context deadline exceeded")
+}
+
+func TestNewErrors(t *testing.T) {
+	cases := map[string]webhook.Options{
+		"noURL":         {},
+		"unknownFormat": {URL: "https://localhost", Format: "other"},
+		"invalidCA":     {URL: "https://localhost", CABundle: []byte("not pem")},
+		// Requests hold secrets, plain http needs to be allowed.
+		"http":          {URL: "http://localhost"},
+		"unknownScheme": {URL: "ftp://localhost", Insecure: true},
+	}
+
+	for name, opts := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := webhook.New(opts)
+			require.Error(t, err)
+		})
+	}
+}
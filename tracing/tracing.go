@@ -0,0 +1,54 @@
+// Package tracing sets up OpenTelemetry tracing for the manager.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlphttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/codeformio/declare"
+
+// Tracer returns the tracer used to instrument Declare. Spans are not
+// recorded unless Setup has been called.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Options configure the exporting of traces.
+type Options struct {
+	// Endpoint is the host:port of an OTLP/HTTP collector.
+	Endpoint string
+	// Insecure disables TLS when connecting to the collector.
+	Insecure bool
+}
+
+// Setup configures the global tracer provider to export spans to an OTLP
+// collector. The returned function flushes any remaining spans and should be
+// called before exiting.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	driverOpts := []otlphttp.Option{otlphttp.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		driverOpts = append(driverOpts, otlphttp.WithInsecure())
+	}
+
+	exporter, err := otlp.NewExporter(ctx, otlphttp.NewDriver(driverOpts...))
+	if err != nil {
+		return nil, fmt.Errorf("creating otlp exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.ServiceNameKey.String("declare"))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
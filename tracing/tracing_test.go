@@ -0,0 +1,55 @@
+package tracing_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/codeformio/declare/tracing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSetup(t *testing.T) {
+	// Stand-in for an OTLP/HTTP collector.
+	requests := make(chan *coltracepb.ExportTraceServiceRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/traces", r.URL.Path)
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		var req coltracepb.ExportTraceServiceRequest
+		require.NoError(t, proto.Unmarshal(body, &req))
+		requests <- &req
+	}))
+	defer collector.Close()
+
+	ctx := context.Background()
+	shutdown, err := tracing.Setup(ctx, tracing.Options{
+		Endpoint: strings.TrimPrefix(collector.URL, "http://"),
+		Insecure: true,
+	})
+	require.NoError(t, err)
+
+	_, span := tracing.Tracer().Start(ctx, "Reconcile")
+	span.SetAttributes(attribute.String("parent.uid", "abc-123"))
+	span.End()
+
+	// Shutdown flushes the spans to the collector.
+	require.NoError(t, shutdown(ctx))
+
+	req := <-requests
+	require.Len(t, req.ResourceSpans, 1)
+	require.Len(t, req.ResourceSpans[0].InstrumentationLibrarySpans, 1)
+	spans := req.ResourceSpans[0].InstrumentationLibrarySpans[0].Spans
+	require.Len(t, spans, 1)
+	require.Equal(t, "Reconcile", spans[0].Name)
+	require.Equal(t, "parent.uid", spans[0].Attributes[0].Key)
+	require.Equal(t, "abc-123", spans[0].Attributes[0].Value.GetStringValue())
+}